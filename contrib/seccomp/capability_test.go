@@ -0,0 +1,68 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRegisterCapabilitySyscallsAppends(t *testing.T) {
+	const testCap = "CAP_TEST_REGISTER_APPENDS"
+
+	RegisterCapabilitySyscalls(testCap, "futex")
+	RegisterCapabilitySyscalls(testCap, "nanosleep")
+
+	syscalls, ok := capabilitySyscalls(testCap)
+	if !ok {
+		t.Fatal("expected the capability to be registered")
+	}
+	if len(syscalls) != 2 || syscalls[0] != "futex" || syscalls[1] != "nanosleep" {
+		t.Fatalf("expected appended syscalls [futex nanosleep], got %v", syscalls)
+	}
+}
+
+// TestCapabilitySyscallsConcurrentAccess exercises RegisterCapabilitySyscalls
+// and capabilitySyscalls (the path DefaultProfile reads through) from many
+// goroutines at once; run with -race to catch a regression of the
+// unsynchronized map access this guards against.
+func TestCapabilitySyscallsConcurrentAccess(t *testing.T) {
+	const testCap = "CAP_TEST_CONCURRENT_ACCESS"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterCapabilitySyscalls(testCap, "getpid")
+		}()
+		go func() {
+			defer wg.Done()
+			capabilitySyscalls(testCap)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCapabilitySyscallsKnownEntries(t *testing.T) {
+	syscalls, ok := capabilitySyscalls("CAP_SYS_ADMIN")
+	if !ok || len(syscalls) == 0 {
+		t.Fatal("expected CAP_SYS_ADMIN to have a default set of syscalls")
+	}
+}
@@ -0,0 +1,170 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	"encoding/json"
+	"sort"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// PatchOp identifies the kind of change a Patch makes to a profile.
+type PatchOp int
+
+const (
+	// PatchAdd adds a rule for Patch.Name, replacing any existing rule for
+	// that name.
+	PatchAdd PatchOp = iota
+	// PatchRemove drops any rule for Patch.Name.
+	PatchRemove
+	// PatchReplace replaces the existing rule for Patch.Name; behaves the
+	// same as PatchAdd, and exists only to make the intent of a diff clear.
+	PatchReplace
+)
+
+// Patch describes a single-syscall change to apply to a profile with
+// Compose. Patch.Rule.Names is ignored; Name is authoritative.
+type Patch struct {
+	Op   PatchOp
+	Name string
+	Rule runtimespec.LinuxSyscall
+}
+
+// Compose returns a new profile built by applying patches, in order, on top
+// of base. base is not modified. Today, users who want "the default plus
+// mount" or "the default minus ptrace" have to reconstruct the whole
+// []LinuxSyscall by hand; Compose lets higher layers (CRI, nerdctl
+// --security-opt) express such deltas directly, including on top of a
+// profile returned by LoadProfile.
+func Compose(base *runtimespec.LinuxSeccomp, patches ...Patch) *runtimespec.LinuxSeccomp {
+	rules := explodeSyscalls(base.Syscalls)
+
+	for _, p := range patches {
+		if p.Op == PatchRemove {
+			delete(rules, p.Name)
+			continue
+		}
+
+		rule := p.Rule
+		rule.Names = []string{p.Name}
+		rules[p.Name] = rule
+	}
+
+	return &runtimespec.LinuxSeccomp{
+		DefaultAction: base.DefaultAction,
+		Architectures: append([]runtimespec.Arch(nil), base.Architectures...),
+		Syscalls:      mergeSyscalls(rules),
+	}
+}
+
+// Diff returns the Patches that, applied to a with Compose, produce a
+// profile equivalent to b. DefaultAction and Architectures are not
+// compared; Diff only concerns itself with per-syscall rules.
+func Diff(a, b *runtimespec.LinuxSeccomp) []Patch {
+	ar := explodeSyscalls(a.Syscalls)
+	br := explodeSyscalls(b.Syscalls)
+
+	names := make(map[string]struct{}, len(ar)+len(br))
+	for n := range ar {
+		names[n] = struct{}{}
+	}
+	for n := range br {
+		names[n] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	var patches []Patch
+	for _, n := range sorted {
+		aRule, inA := ar[n]
+		bRule, inB := br[n]
+
+		switch {
+		case inA && !inB:
+			patches = append(patches, Patch{Op: PatchRemove, Name: n})
+		case !inA && inB:
+			patches = append(patches, Patch{Op: PatchAdd, Name: n, Rule: bRule})
+		case ruleFingerprint(aRule) != ruleFingerprint(bRule):
+			patches = append(patches, Patch{Op: PatchReplace, Name: n, Rule: bRule})
+		}
+	}
+
+	return patches
+}
+
+// explodeSyscalls splits each rule's Names into independent single-name
+// entries, so Compose/Diff can reason about one syscall at a time even
+// though LinuxSeccomp groups syscalls that share a rule together.
+func explodeSyscalls(rules []runtimespec.LinuxSyscall) map[string]runtimespec.LinuxSyscall {
+	out := make(map[string]runtimespec.LinuxSyscall, len(rules))
+	for _, r := range rules {
+		for _, name := range r.Names {
+			single := r
+			single.Names = []string{name}
+			out[name] = single
+		}
+	}
+	return out
+}
+
+// mergeSyscalls is the inverse of explodeSyscalls: single-name rules that
+// are otherwise identical (same action, args, and errno) are folded back
+// into one rule with combined Names, in a deterministic order.
+func mergeSyscalls(rules map[string]runtimespec.LinuxSyscall) []runtimespec.LinuxSyscall {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := map[string][]string{}
+	var order []string
+	for _, name := range names {
+		key := ruleFingerprint(rules[name])
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], name)
+	}
+
+	out := make([]runtimespec.LinuxSyscall, 0, len(order))
+	for _, key := range order {
+		grouped := groups[key]
+		rule := rules[grouped[0]]
+		rule.Names = grouped
+		out = append(out, rule)
+	}
+	return out
+}
+
+// ruleFingerprint returns a value equal for two rules iff they would behave
+// identically apart from which syscall name invokes them.
+func ruleFingerprint(r runtimespec.LinuxSyscall) string {
+	b, _ := json.Marshal(struct {
+		Action   runtimespec.LinuxSeccompAction
+		Args     []runtimespec.LinuxSeccompArg
+		ErrnoRet *uint
+	}{r.Action, r.Args, r.ErrnoRet})
+	return string(b)
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	"testing"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func baseProfile() *runtimespec.LinuxSeccomp {
+	return &runtimespec.LinuxSeccomp{
+		DefaultAction: runtimespec.ActErrno,
+		Architectures: []runtimespec.Arch{runtimespec.ArchX86_64},
+		Syscalls: []runtimespec.LinuxSyscall{
+			{Names: []string{"read", "write"}, Action: runtimespec.ActAllow},
+			{Names: []string{"mount"}, Action: runtimespec.ActErrno},
+		},
+	}
+}
+
+func TestComposeAddRemoveReplace(t *testing.T) {
+	base := baseProfile()
+
+	composed := Compose(base,
+		Patch{Op: PatchRemove, Name: "mount"},
+		Patch{Op: PatchAdd, Name: "ptrace", Rule: runtimespec.LinuxSyscall{Action: runtimespec.ActAllow}},
+		Patch{Op: PatchReplace, Name: "write", Rule: runtimespec.LinuxSyscall{Action: runtimespec.ActErrno}},
+	)
+
+	rules := explodeSyscalls(composed.Syscalls)
+
+	if _, ok := rules["mount"]; ok {
+		t.Fatal("expected mount to be removed")
+	}
+	if r, ok := rules["ptrace"]; !ok || r.Action != runtimespec.ActAllow {
+		t.Fatalf("expected ptrace to be added with ActAllow, got: %v", rules["ptrace"])
+	}
+	if r, ok := rules["read"]; !ok || r.Action != runtimespec.ActAllow {
+		t.Fatalf("expected read to be untouched, got: %v", rules["read"])
+	}
+	if r, ok := rules["write"]; !ok || r.Action != runtimespec.ActErrno {
+		t.Fatalf("expected write to be replaced with ActErrno, got: %v", rules["write"])
+	}
+
+	// base must not be mutated by Compose.
+	baseRules := explodeSyscalls(base.Syscalls)
+	if _, ok := baseRules["mount"]; !ok {
+		t.Fatal("Compose must not mutate base")
+	}
+}
+
+func TestComposeDiffRoundTrip(t *testing.T) {
+	base := baseProfile()
+	target := Compose(base,
+		Patch{Op: PatchRemove, Name: "mount"},
+		Patch{Op: PatchAdd, Name: "ptrace", Rule: runtimespec.LinuxSyscall{Action: runtimespec.ActAllow}},
+	)
+
+	patches := Diff(base, target)
+
+	roundTripped := Compose(base, patches...)
+
+	gotRules := explodeSyscalls(roundTripped.Syscalls)
+	wantRules := explodeSyscalls(target.Syscalls)
+
+	if len(gotRules) != len(wantRules) {
+		t.Fatalf("expected %d rules, got %d", len(wantRules), len(gotRules))
+	}
+	for name, want := range wantRules {
+		got, ok := gotRules[name]
+		if !ok {
+			t.Fatalf("expected rule for %s after round-trip", name)
+		}
+		if ruleFingerprint(got) != ruleFingerprint(want) {
+			t.Fatalf("rule for %s diverged after round-trip: got %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	base := baseProfile()
+	same := Compose(base)
+
+	if patches := Diff(base, same); len(patches) != 0 {
+		t.Fatalf("expected no patches between equivalent profiles, got: %v", patches)
+	}
+}
+
+func TestComposeMergesIdenticalRulesBackTogether(t *testing.T) {
+	base := baseProfile()
+
+	composed := Compose(base,
+		Patch{Op: PatchAdd, Name: "ptrace", Rule: runtimespec.LinuxSyscall{Action: runtimespec.ActAllow}},
+	)
+
+	for _, rule := range composed.Syscalls {
+		names := map[string]bool{}
+		for _, n := range rule.Names {
+			names[n] = true
+		}
+		if names["read"] && names["write"] && names["ptrace"] {
+			return
+		}
+	}
+	t.Fatalf("expected read, write and the newly added ptrace to merge into one ActAllow rule, got: %+v", composed.Syscalls)
+}
+
+func TestMergeSyscallsGroupsIdenticalRules(t *testing.T) {
+	merged := mergeSyscalls(map[string]runtimespec.LinuxSyscall{
+		"read":  {Action: runtimespec.ActAllow},
+		"write": {Action: runtimespec.ActAllow},
+		"mount": {Action: runtimespec.ActErrno},
+	})
+
+	if len(merged) != 2 {
+		t.Fatalf("expected read/write to merge into one rule, got %d rules: %v", len(merged), merged)
+	}
+}
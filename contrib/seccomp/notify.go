@@ -0,0 +1,112 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// compatSyscalls lists syscalls that can fail with ENOSYS on kernels that
+// predate them, even though the libc calling them has no fallback path of
+// its own. Alpine's musl update to time64 syscalls is the motivating case:
+// clock_gettime64 and friends are part of DefaultProfile's allow-list, so
+// they are permitted, but on a pre-5.1 kernel the syscall itself does not
+// exist and the process sees a bare ENOSYS instead of musl transparently
+// retrying the legacy 32-bit call.
+//
+// WithUserNotify routes these syscalls to SCMP_ACT_NOTIFY instead, so that a
+// notify.Notifier listening on the OCI runtime's seccomp listenerPath can
+// service them itself, typically by emulating the call against its older,
+// equivalent syscall. See the notify subpackage's DefaultHandlers.
+var compatSyscalls = []string{
+	"clock_gettime64",
+	"clock_settime64",
+	"clock_adjtime64",
+	"clock_getres_time64",
+	"clock_nanosleep_time64",
+	"timer_gettime64",
+	"timer_settime64",
+	"timerfd_gettime64",
+	"timerfd_settime64",
+	"utimensat_time64",
+	"pselect6_time64",
+	"ppoll_time64",
+	"io_pgetevents_time64",
+	"recvmmsg_time64",
+	"mq_timedsend_time64",
+	"mq_timedreceive_time64",
+	"semtimedop_time64",
+	"rt_sigtimedwait_time64",
+	"futex_time64",
+	"sched_rr_get_interval_time64",
+	"close_range",
+	"faccessat2",
+	"openat2",
+	"clone3",
+	"futex_waitv",
+}
+
+// WithUserNotify rewrites profile in place so that any rule allowing one of
+// compatSyscalls unconditionally (no Args constraint) instead reports it via
+// SCMP_ACT_NOTIFY, splitting affected rules as needed, and returns profile.
+// All other rules, including ones that already special-case one of these
+// syscalls (e.g. the CAP_SYS_ADMIN-gated clone3 ENOSYS rule), are left
+// untouched.
+func WithUserNotify(profile *runtimespec.LinuxSeccomp) *runtimespec.LinuxSeccomp {
+	notify := map[string]struct{}{}
+	for _, n := range compatSyscalls {
+		notify[n] = struct{}{}
+	}
+
+	var (
+		rules       []runtimespec.LinuxSyscall
+		notifyNames []string
+	)
+
+	for _, rule := range profile.Syscalls {
+		if rule.Action != runtimespec.ActAllow || len(rule.Args) != 0 {
+			rules = append(rules, rule)
+			continue
+		}
+
+		var kept []string
+		for _, n := range rule.Names {
+			if _, ok := notify[n]; ok {
+				notifyNames = append(notifyNames, n)
+			} else {
+				kept = append(kept, n)
+			}
+		}
+
+		if len(kept) > 0 {
+			rule.Names = kept
+			rules = append(rules, rule)
+		}
+	}
+
+	if len(notifyNames) > 0 {
+		rules = append(rules, runtimespec.LinuxSyscall{
+			Names:  notifyNames,
+			Action: runtimespec.ActNotify,
+		})
+	}
+
+	profile.Syscalls = rules
+	return profile
+}
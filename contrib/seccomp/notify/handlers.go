@@ -0,0 +1,116 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// armTime64Syscalls maps the time64 syscall numbers Linux added on 32-bit
+// arm (asm-generic/unistd.h's generic time64 block, reused verbatim on ARM
+// EABI) to their names. Other syscalls in compatSyscalls that aren't
+// time-related (close_range, faccessat2, openat2, clone3, futex_waitv) are
+// not arch-specific in the same way and are left for DefaultHandlers
+// callers to register support for as needed.
+var armTime64Syscalls = map[int32]string{
+	403: "clock_gettime64",
+	404: "clock_settime64",
+	405: "clock_adjtime64",
+	406: "clock_getres_time64",
+	407: "clock_nanosleep_time64",
+	408: "timer_gettime64",
+	409: "timer_settime64",
+	410: "timerfd_gettime64",
+	411: "timerfd_settime64",
+	412: "utimensat_time64",
+	413: "pselect6_time64",
+	414: "ppoll_time64",
+	416: "io_pgetevents_time64",
+	417: "recvmmsg_time64",
+	418: "mq_timedsend_time64",
+	419: "mq_timedreceive_time64",
+	420: "semtimedop_time64",
+	421: "rt_sigtimedwait_time64",
+	422: "futex_time64",
+	423: "sched_rr_get_interval_time64",
+}
+
+// syscallName resolves a (arch, nr) pair reported by the kernel in a
+// SeccompData into the syscall name DefaultHandlers and seccomp.compatSyscalls
+// key off. An unrecognized pair returns "".
+func syscallName(arch uint32, nr int32) string {
+	if arch == unix.AUDIT_ARCH_ARM {
+		return armTime64Syscalls[nr]
+	}
+	return ""
+}
+
+// DefaultHandlers returns the handler set that resolves the Alpine-style
+// "clock_gettime(CLOCK_MONOTONIC) failed" symptom: musl built against a
+// time64 ABI calls clock_gettime64 even on kernels too old to have it, and
+// has no fallback of its own. Each handler here emulates its time64 syscall
+// by invoking the kernel's legacy, pre-2038-safe equivalent and widening the
+// result back into the caller's 64-bit struct. Register these on a Notifier
+// with Handle, or use them as a starting point for a larger handler set.
+func DefaultHandlers() map[string]Handler {
+	return map[string]Handler{
+		"clock_gettime64": clockGettime64,
+	}
+}
+
+// clockGettime64 services clock_gettime64(clockid_t, struct __kernel_timespec *)
+// by calling the legacy clock_gettime syscall on the notifier's behalf and
+// writing a widened __kernel_timespec (two 8-byte fields, regardless of
+// arch) back into the target process's memory.
+func clockGettime64(n *Notifier, req *unix.SeccompNotif) (int64, int32, uint32, error) {
+	clockID := int32(req.Data.Args[0])
+	tsPtr := req.Data.Args[1]
+
+	var ts unix.Timespec
+	if err := unix.ClockGettime(clockID, &ts); err != nil {
+		errno, _ := err.(unix.Errno)
+		return 0, int32(errno), 0, nil
+	}
+
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(ts.Sec))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(ts.Nsec))
+
+	if !n.Valid(req.ID) {
+		// The calling process is gone (or its pid was reused); there is
+		// nothing left to write a result into.
+		return 0, int32(unix.ENOENT), 0, nil
+	}
+
+	mem, err := os.OpenFile(fmt.Sprintf("/proc/%d/mem", req.Pid), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, int32(unix.ESRCH), 0, nil
+	}
+	defer mem.Close()
+
+	if _, err := mem.WriteAt(buf[:], int64(tsPtr)); err != nil {
+		return 0, int32(unix.EFAULT), 0, nil
+	}
+
+	return 0, 0, 0, nil
+}
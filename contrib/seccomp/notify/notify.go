@@ -0,0 +1,262 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package notify services SCMP_ACT_NOTIFY seccomp actions delivered over
+// the file descriptor an OCI runtime hands back via its listenerPath
+// handshake (see the Linux kernel's seccomp_unotify(2) and the OCI runtime
+// spec's Linux.Seccomp.ListenerPath). It lets a supervisor process resolve
+// syscalls the container's seccomp profile has deferred to user space,
+// typically to paper over syscalls the kernel is missing (see
+// seccomp.WithUserNotify).
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/containerd/log"
+)
+
+// Handler services one seccomp user notification and returns the value the
+// kernel should report back to the syscall that triggered it. Implementors
+// that need to inspect pointer arguments should read them from
+// /proc/<req.Pid>/mem, re-checking req.ID with (*Notifier).Valid
+// immediately before trusting anything read that way, since the target
+// process may have exited (and its pid been reused) between the
+// notification and the read.
+type Handler func(n *Notifier, req *unix.SeccompNotif) (val int64, errno int32, flags uint32, err error)
+
+// Notifier services seccomp user notifications delivered over a single
+// seccomp-notify file descriptor.
+type Notifier struct {
+	fd int
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Receive listens on listenerPath (an OCI runtime's
+// Linux.Seccomp.ListenerPath) for a single connection carrying a
+// seccomp-notify file descriptor, as produced by the runtime's listenerPath
+// handshake, and returns a Notifier wrapping it along with whatever
+// ListenerMetadata payload the runtime sent alongside it.
+func Receive(ctx context.Context, listenerPath string) (*Notifier, string, error) {
+	_ = os.Remove(listenerPath)
+
+	l, err := net.Listen("unix", listenerPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen on %q: %w", listenerPath, err)
+	}
+	defer l.Close()
+
+	type accepted struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan accepted, 1)
+	go func() {
+		conn, err := l.Accept()
+		ch <- accepted{conn, err}
+	}()
+
+	var conn net.Conn
+	select {
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	case a := <-ch:
+		if a.err != nil {
+			return nil, "", fmt.Errorf("failed to accept seccomp listener connection: %w", a.err)
+		}
+		conn = a.conn
+	}
+	defer conn.Close()
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected connection type %T on seccomp listener %q", conn, listenerPath)
+	}
+
+	fd, metadata, err := recvFD(uc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return New(fd), metadata, nil
+}
+
+// New wraps an already-received seccomp-notify file descriptor fd in a
+// Notifier.
+func New(fd int) *Notifier {
+	return &Notifier{fd: fd, handlers: make(map[string]Handler)}
+}
+
+// Handle registers fn to service notifications for the named syscall,
+// replacing any handler previously registered for it. Syscalls with no
+// registered handler are answered with ENOSYS.
+func (n *Notifier) Handle(syscallName string, fn Handler) {
+	n.mu.Lock()
+	n.handlers[syscallName] = fn
+	n.mu.Unlock()
+}
+
+// Valid reports whether id still identifies a live notification: the kernel
+// discards a notification (and may reuse its target pid) once the
+// notifying syscall is interrupted, so handlers that read the target
+// process's memory should call Valid again immediately before trusting
+// what they read.
+func (n *Notifier) Valid(id uint64) bool {
+	return ioctlNotifIDValid(n.fd, id) == nil
+}
+
+// Run services notifications until ctx is done or Close is called. ctx
+// cancellation cannot interrupt the blocking receive of a pending
+// notification, so callers that need Run to return promptly should call
+// Close rather than (or in addition to) cancelling ctx.
+func (n *Notifier) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		req, err := ioctlNotifRecv(n.fd)
+		if err != nil {
+			if err == unix.EINTR { //nolint:errorlint // raw syscall errno
+				continue
+			}
+			if err == unix.EBADF { //nolint:errorlint // raw syscall errno
+				// The fd was closed out from under us; treat this as a
+				// clean shutdown rather than an error.
+				return nil
+			}
+			return fmt.Errorf("failed to receive seccomp notification: %w", err)
+		}
+
+		go n.service(req)
+	}
+}
+
+// Close closes the Notifier's seccomp-notify file descriptor, causing a
+// concurrent Run to return. Safe to call more than once; only the first
+// call's result is returned.
+func (n *Notifier) Close() error {
+	n.closeOnce.Do(func() {
+		n.closeErr = unix.Close(n.fd)
+	})
+	return n.closeErr
+}
+
+func (n *Notifier) service(req *unix.SeccompNotif) {
+	name := syscallName(req.Data.Arch, req.Data.Nr)
+
+	n.mu.RLock()
+	h, ok := n.handlers[name]
+	n.mu.RUnlock()
+
+	resp := &unix.SeccompNotifResp{ID: req.ID}
+	if !ok {
+		resp.Error = int32(unix.ENOSYS)
+	} else if val, errno, flags, err := h(n, req); err != nil {
+		log.L.WithError(err).WithField("syscall", name).WithField("pid", req.Pid).
+			Warn("seccomp notify handler failed, responding with ENOSYS")
+		resp.Error = int32(unix.ENOSYS)
+	} else {
+		resp.Val, resp.Error, resp.Flags = val, errno, flags
+	}
+
+	if err := ioctlNotifSend(n.fd, resp); err != nil {
+		// ENOENT here means the notifying syscall was already interrupted
+		// (e.g. the process was killed); nothing more to do.
+		if err != unix.ENOENT { //nolint:errorlint // raw syscall errno
+			log.L.WithError(err).WithField("syscall", name).WithField("pid", req.Pid).
+				Warn("failed to send seccomp notify response")
+		}
+	}
+}
+
+func recvFD(uc *net.UnixConn) (int, string, error) {
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return -1, "", err
+	}
+
+	data := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+
+	var (
+		n, oobn int
+		rerr    error
+	)
+	if err := raw.Read(func(s uintptr) bool {
+		n, oobn, _, _, rerr = unix.Recvmsg(int(s), data, oob, 0)
+		return true
+	}); err != nil {
+		return -1, "", err
+	}
+	if rerr != nil {
+		return -1, "", fmt.Errorf("failed to receive seccomp fd: %w", rerr)
+	}
+
+	scms, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to parse control message: %w", err)
+	}
+	if len(scms) == 0 {
+		return -1, "", fmt.Errorf("no control messages received on seccomp listener")
+	}
+
+	fds, err := unix.ParseUnixRights(&scms[0])
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to parse unix rights: %w", err)
+	}
+	if len(fds) == 0 {
+		return -1, "", fmt.Errorf("no file descriptors received on seccomp listener")
+	}
+
+	return fds[0], string(data[:n]), nil
+}
+
+func ioctlNotifRecv(fd int) (*unix.SeccompNotif, error) {
+	var req unix.SeccompNotif
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SECCOMP_IOCTL_NOTIF_RECV, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return nil, errno
+	}
+	return &req, nil
+}
+
+func ioctlNotifSend(fd int, resp *unix.SeccompNotifResp) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SECCOMP_IOCTL_NOTIF_SEND, uintptr(unsafe.Pointer(resp))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func ioctlNotifIDValid(fd int, id uint64) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SECCOMP_IOCTL_NOTIF_ID_VALID, uintptr(unsafe.Pointer(&id))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package notify
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestSyscallName covers the arch/nr resolution used to key DefaultHandlers
+// and a Notifier's registered handlers; the ioctl-backed recv/send/id-valid
+// paths require a live seccomp-notify fd from a real kernel filter and
+// aren't exercised here.
+func TestSyscallName(t *testing.T) {
+	if got, want := syscallName(unix.AUDIT_ARCH_ARM, 403), "clock_gettime64"; got != want {
+		t.Fatalf("syscallName(ARM, 403) = %q, want %q", got, want)
+	}
+	if got := syscallName(unix.AUDIT_ARCH_ARM, 1); got != "" {
+		t.Fatalf("syscallName(ARM, 1) = %q, want empty for an unmapped nr", got)
+	}
+	if got := syscallName(unix.AUDIT_ARCH_X86_64, 403); got != "" {
+		t.Fatalf("syscallName(X86_64, 403) = %q, want empty for a non-arm arch", got)
+	}
+}
+
+func TestDefaultHandlersRegistersClockGettime64(t *testing.T) {
+	handlers := DefaultHandlers()
+	if _, ok := handlers["clock_gettime64"]; !ok {
+		t.Fatal("expected DefaultHandlers to register clock_gettime64")
+	}
+}
+
+// TestHandleLastRegistrationWins exercises Handle's documented
+// replace-on-reregister semantics directly against the Notifier's handler
+// map, without going through service (which requires a live seccomp-notify
+// fd to respond on).
+func TestHandleLastRegistrationWins(t *testing.T) {
+	n := New(-1)
+
+	var calls []string
+	n.Handle("read", func(n *Notifier, req *unix.SeccompNotif) (int64, int32, uint32, error) {
+		calls = append(calls, "first")
+		return 0, 0, 0, nil
+	})
+	n.Handle("read", func(n *Notifier, req *unix.SeccompNotif) (int64, int32, uint32, error) {
+		calls = append(calls, "second")
+		return 0, 0, 0, nil
+	})
+
+	n.mu.RLock()
+	h, ok := n.handlers["read"]
+	n.mu.RUnlock()
+	if !ok {
+		t.Fatal("expected a handler to be registered for read")
+	}
+
+	if _, _, _, err := h(n, &unix.SeccompNotif{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != "second" {
+		t.Fatalf("expected only the second registration to run, got %v", calls)
+	}
+}
+
+// TestValidOnInvalidFD exercises the ioctl failure path: an fd that was
+// never a seccomp-notify fd should never report an id as valid.
+func TestValidOnInvalidFD(t *testing.T) {
+	n := New(-1)
+	if n.Valid(1) {
+		t.Fatal("expected Valid to return false for a bogus fd")
+	}
+}
+
+func TestNotifierCloseIsIdempotent(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	n := New(int(r.Fd()))
+	if err := n.Close(); err != nil {
+		t.Fatalf("expected first Close to succeed, got %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("expected second Close to return the cached nil result, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/containerd/containerd/contrib/seccomp/kernelversion"
+)
+
+//go:embed default.json
+var defaultProfileJSON []byte
+
+// Profile is the JSON document format accepted by LoadProfile. It mirrors
+// the OCI LinuxSeccomp schema, with each Syscall additionally able to carry
+// Includes/Excludes rules that decide, per effective spec and host, whether
+// the syscall should be part of the emitted profile at all.
+type Profile struct {
+	DefaultAction runtimespec.LinuxSeccompAction `json:"defaultAction"`
+	Syscalls      []*Syscall                     `json:"syscalls"`
+}
+
+// Syscall is a single rule in a Profile.
+type Syscall struct {
+	Names    []string                        `json:"names"`
+	Action   runtimespec.LinuxSeccompAction   `json:"action"`
+	Args     []runtimespec.LinuxSeccompArg    `json:"args,omitempty"`
+	ErrnoRet *uint                            `json:"errnoRet,omitempty"`
+	Comment  string                           `json:"comment,omitempty"`
+	Includes *Filter                          `json:"includes,omitempty"`
+	Excludes *Filter                          `json:"excludes,omitempty"`
+}
+
+// Filter conditions a Syscall rule on properties of the effective spec and
+// host. A nil *Filter always matches; a non-nil Filter matches only if every
+// field it sets is satisfied (fields left at their zero value are not
+// constraints).
+type Filter struct {
+	MinKernel string `json:"minKernel,omitempty"`
+	MaxKernel string `json:"maxKernel,omitempty"`
+	// Arches lists SCMP_ARCH_* names. A rule matches if any of them is
+	// either the host's native Architecture.Arch or one of its SubArches,
+	// so a rule can be written against "SCMP_ARCH_AARCH64" or
+	// "SCMP_ARCH_ARM" interchangeably on an arm64 host.
+	Arches []string `json:"arches,omitempty"`
+	Caps   []string `json:"caps,omitempty"`
+}
+
+// LoadProfile parses data as a Profile and evaluates it against sp and the
+// running host, returning the normalized *runtimespec.LinuxSeccomp that
+// DefaultProfile would otherwise have hardcoded. Rules whose Includes don't
+// match, or whose Excludes do, are dropped from the result.
+func LoadProfile(data []byte, sp *runtimespec.Spec) (*runtimespec.LinuxSeccomp, error) {
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode seccomp profile: %w", err)
+	}
+
+	return profile.toLinuxSeccomp(sp)
+}
+
+func (p *Profile) toLinuxSeccomp(sp *runtimespec.Spec) (*runtimespec.LinuxSeccomp, error) {
+	caps := map[string]struct{}{}
+	if sp.Process != nil && sp.Process.Capabilities != nil {
+		for _, c := range sp.Process.Capabilities.Bounding {
+			caps[c] = struct{}{}
+		}
+	}
+
+	s := &runtimespec.LinuxSeccomp{
+		DefaultAction: p.DefaultAction,
+		Architectures: arches(),
+	}
+
+	for _, rule := range p.Syscalls {
+		ok, err := matchesFilter(rule.Includes, caps, true)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating includes for %v: %w", rule.Names, err)
+		}
+		if !ok {
+			continue
+		}
+
+		excluded, err := matchesFilter(rule.Excludes, caps, false)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating excludes for %v: %w", rule.Names, err)
+		}
+		if excluded {
+			continue
+		}
+
+		s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
+			Names:    rule.Names,
+			Action:   rule.Action,
+			Args:     rule.Args,
+			ErrnoRet: rule.ErrnoRet,
+		})
+	}
+
+	return s, nil
+}
+
+// matchesFilter evaluates f. defaultResult is returned unchanged for a nil
+// filter, so that Includes defaults to "always applies" (true) and Excludes
+// defaults to "never excludes" (false).
+func matchesFilter(f *Filter, caps map[string]struct{}, defaultResult bool) (bool, error) {
+	if f == nil {
+		return defaultResult, nil
+	}
+
+	if len(f.Arches) > 0 && !archesMatch(f.Arches) {
+		return false, nil
+	}
+
+	if len(f.Caps) > 0 {
+		found := false
+		for _, c := range f.Caps {
+			if _, ok := caps[c]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if f.MinKernel != "" {
+		ok, err := kernelAtLeast(f.MinKernel)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	if f.MaxKernel != "" {
+		ok, err := kernelAtMost(f.MaxKernel)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// archesMatch reports whether any of wanted (SCMP_ARCH_* names) is among the
+// architectures native or sub-native to the running host.
+func archesMatch(wanted []string) bool {
+	host := arches()
+	for _, w := range wanted {
+		for _, a := range host {
+			if string(a) == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func kernelAtLeast(version string) (bool, error) {
+	v, err := parseKernelVersion(version)
+	if err != nil {
+		return false, err
+	}
+	return kernelversion.GreaterEqualThan(v)
+}
+
+// kernelAtMost reports whether the running kernel is no newer than version.
+// It is derived from kernelversion.GreaterEqualThan, which only answers
+// "is the host at least this version"; the host is at most version precisely
+// when it is not at least the next one up, at the same (Kernel, Major)
+// granularity kernelversion itself works in.
+func kernelAtMost(version string) (bool, error) {
+	v, err := parseKernelVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	ge, err := kernelversion.GreaterEqualThan(kernelversion.KernelVersion{Kernel: v.Kernel, Major: v.Major + 1})
+	if err != nil {
+		return false, err
+	}
+	return !ge, nil
+}
+
+func parseKernelVersion(version string) (kernelversion.KernelVersion, error) {
+	var v kernelversion.KernelVersion
+	if _, err := fmt.Sscanf(version, "%d.%d", &v.Kernel, &v.Major); err != nil {
+		return kernelversion.KernelVersion{}, fmt.Errorf("invalid kernel version %q: %w", version, err)
+	}
+	return v, nil
+}
+
+// defaultProfile is equivalent to DefaultProfile, but driven by the embedded
+// default.json instead of Go code, so that operators can start from the
+// same JSON document containerd ships and override just the parts they need
+// without recompiling.
+//
+// Rules in default.json conditioned on arches only match on hosts whose
+// runtime.GOARCH has an Arches mapping; on other hosts (e.g. ppc64le, 386 and
+// 32-bit arm) those rules are dropped, whereas DefaultProfile selects its
+// arch-specific rules by runtime.GOARCH directly.
+func defaultProfile(sp *runtimespec.Spec) (*runtimespec.LinuxSeccomp, error) {
+	return LoadProfile(defaultProfileJSON, sp)
+}
@@ -20,6 +20,7 @@ package seccomp
 
 import (
 	"runtime"
+	"sync"
 
 	"golang.org/x/sys/unix"
 
@@ -28,28 +29,130 @@ import (
 	"github.com/containerd/containerd/contrib/seccomp/kernelversion"
 )
 
-func arches() []runtimespec.Arch {
+// capabilitySyscallsMu guards CapabilitySyscalls, since RegisterCapabilitySyscalls
+// is expected to be called by plugin/init code that can run concurrently with
+// DefaultProfile calls on other goroutines.
+var capabilitySyscallsMu sync.RWMutex
+
+// CapabilitySyscalls maps a capability to the extra syscalls DefaultProfile
+// allows a process that holds it in its bounding set. It is exported, and
+// extensible via RegisterCapabilitySyscalls, so that runtimes carrying
+// capabilities DefaultProfile doesn't know about (e.g. out-of-tree or
+// newer kernel capabilities) can teach it the syscalls they imply without
+// forking this package.
+//
+// Callers must go through RegisterCapabilitySyscalls rather than writing to
+// this map directly; concurrent reads happen from DefaultProfile and are
+// synchronized against RegisterCapabilitySyscalls internally, not against
+// direct map access.
+var CapabilitySyscalls = map[string][]string{
+	"CAP_DAC_READ_SEARCH": {"open_by_handle_at"},
+	"CAP_SYS_ADMIN": {
+		"bpf",
+		"clone",
+		"clone3",
+		"fanotify_init",
+		"fsconfig",
+		"fsmount",
+		"fsopen",
+		"fspick",
+		"lookup_dcookie",
+		"mount",
+		"mount_setattr",
+		"move_mount",
+		"open_tree",
+		"perf_event_open",
+		"quotactl",
+		"quotactl_fd",
+		"setdomainname",
+		"sethostname",
+		"setns",
+		"syslog",
+		"umount",
+		"umount2",
+		"unshare",
+	},
+	"CAP_SYS_BOOT":       {"reboot"},
+	"CAP_SYS_CHROOT":     {"chroot"},
+	"CAP_SYS_MODULE":     {"delete_module", "init_module", "finit_module"},
+	"CAP_SYS_PACCT":      {"acct"},
+	"CAP_SYS_PTRACE":     {"kcmp", "pidfd_getfd", "process_madvise", "process_vm_readv", "process_vm_writev", "ptrace"},
+	"CAP_SYS_RAWIO":      {"iopl", "ioperm"},
+	"CAP_SYS_TIME":       {"settimeofday", "stime", "clock_settime", "clock_settime64"},
+	"CAP_SYS_TTY_CONFIG": {"vhangup"},
+	"CAP_SYS_NICE":       {"get_mempolicy", "mbind", "set_mempolicy"},
+	"CAP_SYSLOG":         {"syslog"},
+	"CAP_BPF":            {"bpf"},
+	"CAP_PERFMON":        {"perf_event_open"},
+}
+
+// RegisterCapabilitySyscalls appends syscalls to the set DefaultProfile
+// allows when cap is in a process's bounding capability set. It does not
+// replace syscalls already registered for cap. Safe to call concurrently
+// with DefaultProfile and with other calls to RegisterCapabilitySyscalls.
+func RegisterCapabilitySyscalls(cap string, syscalls ...string) {
+	capabilitySyscallsMu.Lock()
+	defer capabilitySyscallsMu.Unlock()
+
+	CapabilitySyscalls[cap] = append(CapabilitySyscalls[cap], syscalls...)
+}
+
+// capabilitySyscalls returns the syscalls registered for cap, synchronized
+// against concurrent RegisterCapabilitySyscalls calls.
+func capabilitySyscalls(cap string) ([]string, bool) {
+	capabilitySyscallsMu.RLock()
+	defer capabilitySyscallsMu.RUnlock()
+
+	syscalls, ok := CapabilitySyscalls[cap]
+	return syscalls, ok
+}
+
+// Architecture pairs a native seccomp architecture with the additional
+// "compatibility" architectures the kernel also accepts syscalls from when
+// running on that native arch (e.g. an AARCH64 kernel also accepts ARM
+// syscalls from 32-bit binaries). This mirrors the archMap concept used by
+// moby and Kubernetes seccomp profiles.
+type Architecture struct {
+	Arch      runtimespec.Arch
+	SubArches []runtimespec.Arch
+}
+
+// Arches returns the Architecture describing the running host's native
+// seccomp architecture and its sub-arches, or nil if runtime.GOARCH has no
+// defined mapping.
+func Arches() []Architecture {
 	switch runtime.GOARCH {
 	case "amd64":
-		return []runtimespec.Arch{runtimespec.ArchX86_64, runtimespec.ArchX86, runtimespec.ArchX32}
+		return []Architecture{{Arch: runtimespec.ArchX86_64, SubArches: []runtimespec.Arch{runtimespec.ArchX86, runtimespec.ArchX32}}}
 	case "arm64":
-		return []runtimespec.Arch{runtimespec.ArchARM, runtimespec.ArchAARCH64}
+		return []Architecture{{Arch: runtimespec.ArchAARCH64, SubArches: []runtimespec.Arch{runtimespec.ArchARM}}}
 	case "mips64":
-		return []runtimespec.Arch{runtimespec.ArchMIPS, runtimespec.ArchMIPS64, runtimespec.ArchMIPS64N32}
+		return []Architecture{{Arch: runtimespec.ArchMIPS64, SubArches: []runtimespec.Arch{runtimespec.ArchMIPS, runtimespec.ArchMIPS64N32}}}
 	case "mips64n32":
-		return []runtimespec.Arch{runtimespec.ArchMIPS, runtimespec.ArchMIPS64, runtimespec.ArchMIPS64N32}
+		return []Architecture{{Arch: runtimespec.ArchMIPS64N32, SubArches: []runtimespec.Arch{runtimespec.ArchMIPS, runtimespec.ArchMIPS64}}}
 	case "mipsel64":
-		return []runtimespec.Arch{runtimespec.ArchMIPSEL, runtimespec.ArchMIPSEL64, runtimespec.ArchMIPSEL64N32}
+		return []Architecture{{Arch: runtimespec.ArchMIPSEL64, SubArches: []runtimespec.Arch{runtimespec.ArchMIPSEL, runtimespec.ArchMIPSEL64N32}}}
 	case "mipsel64n32":
-		return []runtimespec.Arch{runtimespec.ArchMIPSEL, runtimespec.ArchMIPSEL64, runtimespec.ArchMIPSEL64N32}
+		return []Architecture{{Arch: runtimespec.ArchMIPSEL64N32, SubArches: []runtimespec.Arch{runtimespec.ArchMIPSEL, runtimespec.ArchMIPSEL64}}}
 	case "s390x":
-		return []runtimespec.Arch{runtimespec.ArchS390, runtimespec.ArchS390X}
+		return []Architecture{{Arch: runtimespec.ArchS390X, SubArches: []runtimespec.Arch{runtimespec.ArchS390}}}
 	case "riscv64":
 		// ArchRISCV32 (SCMP_ARCH_RISCV32) does not exist
-		return []runtimespec.Arch{runtimespec.ArchRISCV64}
+		return []Architecture{{Arch: runtimespec.ArchRISCV64}}
 	default:
-		return []runtimespec.Arch{}
+		return nil
+	}
+}
+
+// arches flattens Arches() into the native-plus-sub-arches list that
+// LinuxSeccomp.Architectures expects.
+func arches() []runtimespec.Arch {
+	var out []runtimespec.Arch
+	for _, a := range Arches() {
+		out = append(out, a.Arch)
+		out = append(out, a.SubArches...)
 	}
+	return out
 }
 
 // DefaultProfile defines the allowed syscalls for the default seccomp profile.
@@ -564,136 +667,13 @@ func DefaultProfile(sp *runtimespec.Spec) *runtimespec.LinuxSeccomp {
 
 	admin := false
 	for _, c := range sp.Process.Capabilities.Bounding {
-		switch c {
-		case "CAP_DAC_READ_SEARCH":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"open_by_handle_at"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_ADMIN":
+		if c == "CAP_SYS_ADMIN" {
 			admin = true
+		}
+
+		if syscalls, ok := capabilitySyscalls(c); ok {
 			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names: []string{
-					"bpf",
-					"clone",
-					"clone3",
-					"fanotify_init",
-					"fsconfig",
-					"fsmount",
-					"fsopen",
-					"fspick",
-					"lookup_dcookie",
-					"mount",
-					"mount_setattr",
-					"move_mount",
-					"open_tree",
-					"perf_event_open",
-					"quotactl",
-					"quotactl_fd",
-					"setdomainname",
-					"sethostname",
-					"setns",
-					"syslog",
-					"umount",
-					"umount2",
-					"unshare",
-				},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_BOOT":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"reboot"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_CHROOT":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"chroot"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_MODULE":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names: []string{
-					"delete_module",
-					"init_module",
-					"finit_module",
-				},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_PACCT":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"acct"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_PTRACE":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names: []string{
-					"kcmp",
-					"pidfd_getfd",
-					"process_madvise",
-					"process_vm_readv",
-					"process_vm_writev",
-					"ptrace",
-				},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_RAWIO":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names: []string{
-					"iopl",
-					"ioperm",
-				},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_TIME":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names: []string{
-					"settimeofday",
-					"stime",
-					"clock_settime",
-					"clock_settime64",
-				},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_TTY_CONFIG":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"vhangup"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYS_NICE":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names: []string{
-					"get_mempolicy",
-					"mbind",
-					"set_mempolicy",
-				},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_SYSLOG":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"syslog"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_BPF":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"bpf"},
-				Action: runtimespec.ActAllow,
-				Args:   []runtimespec.LinuxSeccompArg{},
-			})
-		case "CAP_PERFMON":
-			s.Syscalls = append(s.Syscalls, runtimespec.LinuxSyscall{
-				Names:  []string{"perf_event_open"},
+				Names:  syscalls,
 				Action: runtimespec.ActAllow,
 				Args:   []runtimespec.LinuxSeccompArg{},
 			})
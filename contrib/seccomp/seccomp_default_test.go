@@ -0,0 +1,57 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestArchesKnownGOARCH(t *testing.T) {
+	known := map[string]bool{
+		"amd64": true, "arm64": true, "mips64": true, "mips64n32": true,
+		"mipsel64": true, "mipsel64n32": true, "s390x": true, "riscv64": true,
+	}
+	if !known[runtime.GOARCH] {
+		t.Skipf("no Architecture mapping defined for GOARCH %s", runtime.GOARCH)
+	}
+
+	archs := Arches()
+	if len(archs) != 1 {
+		t.Fatalf("expected exactly one Architecture for %s, got %d", runtime.GOARCH, len(archs))
+	}
+	if archs[0].Arch == "" {
+		t.Fatal("expected a native Arch to be set")
+	}
+}
+
+func TestArchesFlattensNativeAndSubArches(t *testing.T) {
+	known := Arches()
+	if len(known) == 0 {
+		t.Skip("no Architecture mapping defined for this GOARCH")
+	}
+
+	flat := arches()
+	if len(flat) != 1+len(known[0].SubArches) {
+		t.Fatalf("expected arches() to flatten native arch plus %d sub-arches, got %d entries: %v", len(known[0].SubArches), len(flat), flat)
+	}
+	if flat[0] != known[0].Arch {
+		t.Fatalf("expected arches()[0] to be the native arch %s, got %s", known[0].Arch, flat[0])
+	}
+}
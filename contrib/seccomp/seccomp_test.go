@@ -0,0 +1,133 @@
+//go:build linux
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package seccomp
+
+import (
+	"encoding/json"
+	"testing"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func specWithCaps(caps ...string) *runtimespec.Spec {
+	return &runtimespec.Spec{
+		Process: &runtimespec.Process{
+			Capabilities: &runtimespec.LinuxCapabilities{
+				Bounding: caps,
+			},
+		},
+	}
+}
+
+func TestLoadProfileIncludeExcludeByCapability(t *testing.T) {
+	profile := Profile{
+		DefaultAction: runtimespec.ActErrno,
+		Syscalls: []*Syscall{
+			{
+				Names:    []string{"mount"},
+				Action:   runtimespec.ActAllow,
+				Includes: &Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				Names:    []string{"setuid"},
+				Action:   runtimespec.ActAllow,
+				Excludes: &Filter{Caps: []string{"CAP_SETUID"}},
+			},
+			{
+				Names:  []string{"read"},
+				Action: runtimespec.ActAllow,
+			},
+		},
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("capability present", func(t *testing.T) {
+		s, err := LoadProfile(data, specWithCaps("CAP_SYS_ADMIN", "CAP_SETUID"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := ruleNames(s.Syscalls)
+		if !names["mount"] {
+			t.Fatal("expected mount to be included when CAP_SYS_ADMIN is held")
+		}
+		if names["setuid"] {
+			t.Fatal("expected setuid to be excluded when CAP_SETUID is held")
+		}
+		if !names["read"] {
+			t.Fatal("expected an unconditional rule to always be included")
+		}
+	})
+
+	t.Run("capability absent", func(t *testing.T) {
+		s, err := LoadProfile(data, specWithCaps())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := ruleNames(s.Syscalls)
+		if names["mount"] {
+			t.Fatal("expected mount to be dropped without CAP_SYS_ADMIN")
+		}
+		if !names["setuid"] {
+			t.Fatal("expected setuid to be kept without CAP_SETUID")
+		}
+	})
+}
+
+func TestMatchesFilterNilDefaults(t *testing.T) {
+	ok, err := matchesFilter(nil, nil, true)
+	if err != nil || !ok {
+		t.Fatalf("expected nil Includes filter to default to true, got %v, %v", ok, err)
+	}
+
+	ok, err = matchesFilter(nil, nil, false)
+	if err != nil || ok {
+		t.Fatalf("expected nil Excludes filter to default to false, got %v, %v", ok, err)
+	}
+}
+
+func TestArchesMatchHostNative(t *testing.T) {
+	host := arches()
+	if len(host) == 0 {
+		t.Skip("no known architecture mapping for this GOARCH")
+	}
+
+	if !archesMatch([]string{string(host[0])}) {
+		t.Fatalf("expected the host's own native arch %s to match", host[0])
+	}
+
+	if archesMatch([]string{"SCMP_ARCH_DOES_NOT_EXIST"}) {
+		t.Fatal("expected an unknown arch name not to match")
+	}
+}
+
+func ruleNames(rules []runtimespec.LinuxSyscall) map[string]bool {
+	out := map[string]bool{}
+	for _, r := range rules {
+		for _, n := range r.Names {
+			out[n] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	distref "github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/log"
+)
+
+// CachingResolver wraps a Resolver so that manifest and index fetches are
+// served from store whenever the requested digest is already present,
+// avoiding a registry round-trip on repeat pulls of the same content (even
+// when the content is reached through a different tag). Resolve still talks
+// to the registry, since a tag may have moved, but the resulting descriptor's
+// bytes are only fetched over the network once per digest.
+//
+// Cached manifests and indexes are written under lm, with a
+// containerd.io/distribution.source.<registry> label recording the
+// repository that served the content and containerd.io/gc.ref.content.<n>
+// labels for each child reference, so the cached blob and its children are
+// kept alive together.
+func CachingResolver(base Resolver, store content.Store, lm leases.Manager) Resolver {
+	return &cachingResolver{base: base, store: store, leases: lm}
+}
+
+type cachingResolver struct {
+	base   Resolver
+	store  content.Store
+	leases leases.Manager
+}
+
+func (r *cachingResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	return r.base.Resolve(ctx, ref)
+}
+
+func (r *cachingResolver) Fetcher(ctx context.Context, ref string) (Fetcher, error) {
+	f, err := r.base.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, repo := refParts(ref)
+
+	return &cachingFetcher{
+		base:     f,
+		store:    r.store,
+		leases:   r.leases,
+		registry: registry,
+		repo:     repo,
+	}, nil
+}
+
+func (r *cachingResolver) Pusher(ctx context.Context, ref string) (Pusher, error) {
+	return r.base.Pusher(ctx, ref)
+}
+
+type cachingFetcher struct {
+	base     Fetcher
+	store    content.Store
+	leases   leases.Manager
+	registry string
+	repo     string
+}
+
+func (f *cachingFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if !isManifestType(desc.MediaType) {
+		return f.base.Fetch(ctx, desc)
+	}
+
+	ra, err := f.store.ReaderAt(ctx, desc)
+	if err == nil {
+		log.G(ctx).WithField("digest", desc.Digest).Debug("serving manifest from cache")
+		return content.NewReader(ra), nil
+	}
+
+	rc, err := f.base.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fetched manifest %s: %w", desc.Digest, err)
+	}
+
+	if err := f.cache(ctx, desc, b); err != nil {
+		// Caching is an optimization; a failure here should not fail the
+		// pull that is already in flight.
+		log.G(ctx).WithError(err).WithField("digest", desc.Digest).Warn("failed to cache manifest")
+	}
+
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// cache commits the fetched manifest/index bytes to the content store under
+// a lease, recording where it came from and what it references so both
+// survive garbage collection together.
+func (f *cachingFetcher) cache(ctx context.Context, desc ocispec.Descriptor, b []byte) error {
+	if dgst := digest.FromBytes(b); dgst != desc.Digest {
+		return fmt.Errorf("fetched content digest mismatch: expected %s, got %s", desc.Digest, dgst)
+	}
+
+	l, err := f.leases.Create(ctx, leases.WithRandomID(), leases.WithExpiration(0))
+	if err != nil {
+		return fmt.Errorf("failed to create lease for cached manifest: %w", err)
+	}
+	ctx = leases.WithLease(ctx, l.ID)
+
+	labels := map[string]string{}
+	if f.registry != "" && f.repo != "" {
+		labels[distributionSourceLabelKey(f.registry)] = appendDistributionSourceLabel("", f.repo)
+	}
+
+	// desc has not been committed to the store yet, so images.Children
+	// (which reads back through the store) cannot see it; parse the
+	// children directly out of the bytes already in hand instead.
+	children, err := childrenFromManifest(desc.MediaType, b)
+	if err != nil {
+		log.G(ctx).WithError(err).WithField("digest", desc.Digest).Debug("failed to parse children for gc labels")
+	}
+	for i, c := range children {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = c.Digest.String()
+	}
+
+	ref := fmt.Sprintf("cache-%s", desc.Digest)
+	return content.WriteBlob(ctx, f.store, ref, bytes.NewReader(b), desc, content.WithLabels(labels))
+}
+
+// childrenFromManifest unmarshals a manifest or index's raw bytes to find
+// its child descriptors, mirroring images.Children without requiring the
+// content to already be readable from a store.
+func childrenFromManifest(mediaType string, b []byte) ([]ocispec.Descriptor, error) {
+	switch {
+	case images.IsIndexType(mediaType):
+		var idx ocispec.Index
+		if err := json.Unmarshal(b, &idx); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal index: %w", err)
+		}
+		return idx.Manifests, nil
+	case images.IsManifestType(mediaType):
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+		}
+		return append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...), nil
+	default:
+		return nil, fmt.Errorf("unsupported media type for children: %s", mediaType)
+	}
+}
+
+func isManifestType(mt string) bool {
+	return images.IsManifestType(mt) || images.IsIndexType(mt)
+}
+
+// refParts splits an image reference into its registry host and repository
+// path, returning empty strings if ref cannot be parsed as a named
+// reference.
+func refParts(ref string) (registry, repo string) {
+	named, err := distref.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", ""
+	}
+	return distref.Domain(named), distref.Path(named)
+}
@@ -0,0 +1,136 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"bytes"
+	"context"
+	_ "crypto/sha256"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/leases"
+)
+
+type fakeFetcher struct {
+	body []byte
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.body)), nil
+}
+
+// fakeLeaseManager discards everything; cache only needs a lease ID to
+// attach to the WriteBlob context.
+type fakeLeaseManager struct{}
+
+func (fakeLeaseManager) Create(ctx context.Context, opts ...leases.Opt) (leases.Lease, error) {
+	l := leases.Lease{ID: "test"}
+	for _, o := range opts {
+		if err := o(&l); err != nil {
+			return leases.Lease{}, err
+		}
+	}
+	return l, nil
+}
+
+func (fakeLeaseManager) Delete(ctx context.Context, l leases.Lease, opts ...leases.DeleteOpt) error {
+	return nil
+}
+
+func (fakeLeaseManager) List(ctx context.Context, filters ...string) ([]leases.Lease, error) {
+	return nil, nil
+}
+
+func (fakeLeaseManager) AddResource(ctx context.Context, l leases.Lease, r leases.Resource) error {
+	return nil
+}
+
+func (fakeLeaseManager) DeleteResource(ctx context.Context, l leases.Lease, r leases.Resource) error {
+	return nil
+}
+
+func (fakeLeaseManager) ListResources(ctx context.Context, l leases.Lease) ([]leases.Resource, error) {
+	return nil, nil
+}
+
+// TestCachingFetcherLabelsChildren verifies that caching a freshly fetched
+// manifest records a containerd.io/gc.ref.content.<n> label for each of its
+// children, so the cached manifest and its references are garbage
+// collected together. This exercises the cache round-trip without relying
+// on the manifest already being readable from the store, since it isn't
+// yet when cache computes these labels.
+func TestCachingFetcherLabelsChildren(t *testing.T) {
+	ctx := context.Background()
+
+	config := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromString("config"), Size: 1}
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer"), Size: 1}
+
+	manifest := ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+	}
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &cachingFetcher{
+		base:   &fakeFetcher{body: b},
+		store:  cs,
+		leases: fakeLeaseManager{},
+	}
+
+	rc, err := f.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	info, err := cs.Info(ctx, desc.Digest)
+	if err != nil {
+		t.Fatalf("expected manifest to be committed to the store: %v", err)
+	}
+
+	if got := info.Labels["containerd.io/gc.ref.content.0"]; got != config.Digest.String() {
+		t.Fatalf("expected gc.ref.content.0 %s, got %q", config.Digest, got)
+	}
+	if got := info.Labels["containerd.io/gc.ref.content.1"]; got != layer.Digest.String() {
+		t.Fatalf("expected gc.ref.content.1 %s, got %q", layer.Digest, got)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	"encoding/json"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+)
+
+// FilterPlatforms wraps f so that, when dispatching the children of an
+// index or manifest list, only descriptors whose Platform matches m are
+// passed through; among several candidates for the same platform, only the
+// one m prefers (per m.Less) is kept. This complements
+// SkipNonDistributableBlobs by letting callers avoid fetching manifests for
+// platforms they will never unpack, which matters most when pulling large
+// multi-arch indexes over slow links.
+//
+// A child with no Platform set is always fetched, since the index alone
+// doesn't say what platform it targets. Once dispatch calls FilterPlatforms
+// again on the fetched manifest, its embedded image config is read from
+// provider and matched against m; a mismatch drops the manifest's own
+// children so its layers are never fetched.
+func FilterPlatforms(f images.Handler, m platforms.MatchComparer, provider content.Provider) images.HandlerFunc {
+	return func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		children, err := f.Handle(ctx, desc)
+		if err != nil || len(children) == 0 {
+			return children, err
+		}
+
+		if images.IsIndexType(desc.MediaType) {
+			return filterChildren(children, m), nil
+		}
+
+		if images.IsManifestType(desc.MediaType) {
+			return filterManifestChildren(ctx, provider, children, m)
+		}
+
+		return children, nil
+	}
+}
+
+// filterManifestChildren reads the platform recorded in a manifest's
+// embedded image config and drops children (the config and layer
+// descriptors returned by the inner handler) when it doesn't match m. A
+// manifest whose config can't be read or parsed is passed through
+// unfiltered, since FilterPlatforms is an optimization and the rest of the
+// dispatch pipeline is better placed to report a hard failure on it.
+func filterManifestChildren(ctx context.Context, provider content.Provider, children []ocispec.Descriptor, m platforms.MatchComparer) ([]ocispec.Descriptor, error) {
+	if provider == nil {
+		return children, nil
+	}
+
+	config := children[0]
+
+	b, err := content.ReadBlob(ctx, provider, config)
+	if err != nil {
+		return children, nil
+	}
+
+	var image ocispec.Image
+	if err := json.Unmarshal(b, &image); err != nil {
+		return children, nil
+	}
+
+	platform := ocispec.Platform{
+		Architecture: image.Architecture,
+		OS:           image.OS,
+		Variant:      image.Variant,
+	}
+	if !m.Match(platform) {
+		return nil, nil
+	}
+
+	return children, nil
+}
+
+func filterChildren(children []ocispec.Descriptor, m platforms.MatchComparer) []ocispec.Descriptor {
+	var (
+		withoutPlatform []ocispec.Descriptor
+		best            = map[string]ocispec.Descriptor{}
+		order           []string
+	)
+
+	for _, c := range children {
+		if c.Platform == nil {
+			withoutPlatform = append(withoutPlatform, c)
+			continue
+		}
+
+		if !m.Match(*c.Platform) {
+			continue
+		}
+
+		key := platforms.Format(*c.Platform)
+		prev, ok := best[key]
+		if !ok {
+			order = append(order, key)
+			best[key] = c
+			continue
+		}
+
+		if m.Less(*c.Platform, *prev.Platform) {
+			best[key] = c
+		}
+	}
+
+	out := withoutPlatform
+	for _, key := range order {
+		out = append(out, best[key])
+	}
+
+	return out
+}
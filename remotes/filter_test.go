@@ -0,0 +1,125 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	_ "crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+)
+
+func TestFilterPlatformsIndex(t *testing.T) {
+	ctx := context.Background()
+	m := platforms.Only(imagespec.Platform{OS: "linux", Architecture: "amd64"})
+
+	h := FilterPlatforms(images.HandlerFunc(func(ctx context.Context, desc imagespec.Descriptor) ([]imagespec.Descriptor, error) {
+		return []imagespec.Descriptor{
+			{Digest: "test:1", Platform: &imagespec.Platform{OS: "linux", Architecture: "amd64"}},
+			{Digest: "test:2", Platform: &imagespec.Platform{OS: "linux", Architecture: "arm64"}},
+		}, nil
+	}), m, nil)
+
+	out, err := h(ctx, imagespec.Descriptor{MediaType: imagespec.MediaTypeImageIndex})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 1 || out[0].Digest != "test:1" {
+		t.Fatalf("expected only the matching manifest, got: %v", out)
+	}
+}
+
+func TestFilterPlatformsManifest(t *testing.T) {
+	ctx := context.Background()
+	m := platforms.Only(imagespec.Platform{OS: "linux", Architecture: "amd64"})
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(i interface{}, ref string) digest.Digest {
+		t.Helper()
+
+		data, err := json.Marshal(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := cs.Writer(ctx, content.WithRef(ref))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		dgst := digest.SHA256.FromBytes(data)
+
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Commit(ctx, int64(len(data)), dgst); err != nil {
+			t.Fatal(err)
+		}
+
+		return dgst
+	}
+
+	children := func(platform imagespec.Platform) []imagespec.Descriptor {
+		configDigest := write(imagespec.Image{Platform: platform}, platform.Architecture+"-config")
+		return []imagespec.Descriptor{
+			{Digest: configDigest, MediaType: imagespec.MediaTypeImageConfig},
+			{Digest: "test:1", MediaType: imagespec.MediaTypeImageLayer},
+		}
+	}
+
+	matching := children(imagespec.Platform{OS: "linux", Architecture: "amd64"})
+	h := FilterPlatforms(images.HandlerFunc(func(ctx context.Context, desc imagespec.Descriptor) ([]imagespec.Descriptor, error) {
+		return matching, nil
+	}), m, cs)
+
+	out, err := h(ctx, imagespec.Descriptor{MediaType: imagespec.MediaTypeImageManifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(matching) {
+		t.Fatalf("expected manifest for the matching platform to be kept, got: %v", out)
+	}
+
+	mismatched := children(imagespec.Platform{OS: "linux", Architecture: "arm64"})
+	h = FilterPlatforms(images.HandlerFunc(func(ctx context.Context, desc imagespec.Descriptor) ([]imagespec.Descriptor, error) {
+		return mismatched, nil
+	}), m, cs)
+
+	out, err = h(ctx, imagespec.Descriptor{MediaType: imagespec.MediaTypeImageManifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 {
+		t.Fatalf("expected manifest for a mismatched platform to be dropped, got: %v", out)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+)
+
+// distributionURLsLabel records the URLs a foreign layer was fetched from,
+// so that a later push can re-emit the descriptor with its URLs intact
+// instead of attempting (and failing) to upload non-distributable content.
+const distributionURLsLabel = "containerd.io/distribution.urls"
+
+// URLFetcherOpts configures a URLFetcher.
+type URLFetcherOpts struct {
+	// Client issues the HTTP requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// AllowedHosts restricts fetches to the given hosts. A nil map allows
+	// any host.
+	AllowedHosts map[string]struct{}
+	// AllowedSchemes restricts fetches to the given URL schemes. A nil map
+	// defaults to allowing only "https".
+	AllowedSchemes map[string]struct{}
+}
+
+// URLFetcher is a Fetcher that retrieves content from the URLs embedded in a
+// descriptor rather than from a registry, for use with foreign/
+// non-distributable layers whose bytes are hosted outside of the registry
+// that served the image manifest.
+type URLFetcher struct {
+	client  *http.Client
+	hosts   map[string]struct{}
+	schemes map[string]struct{}
+}
+
+// NewURLFetcher returns a URLFetcher configured with opts.
+func NewURLFetcher(opts URLFetcherOpts) *URLFetcher {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	schemes := opts.AllowedSchemes
+	if schemes == nil {
+		schemes = map[string]struct{}{"https": {}}
+	}
+
+	return &URLFetcher{client: client, hosts: opts.AllowedHosts, schemes: schemes}
+}
+
+// Fetch tries each URL in desc.URLs in order, spooling the response to a
+// temp file and verifying it against desc's digest and size before
+// returning it; a URL that responds but fails verification is discarded and
+// the next URL is tried, rather than being handed to the caller as if it
+// had succeeded.
+func (f *URLFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if len(desc.URLs) == 0 {
+		return nil, fmt.Errorf("descriptor %s has no URLs to fetch from", desc.Digest)
+	}
+
+	var lastErr error
+	for _, ref := range desc.URLs {
+		rc, err := f.fetchOne(ctx, ref, desc)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return rc, nil
+	}
+
+	return nil, fmt.Errorf("failed to fetch %s from any of %d URLs: %w", desc.Digest, len(desc.URLs), lastErr)
+}
+
+// fetchOne retrieves ref and spools it to a temp file, verifying the spooled
+// bytes against desc before returning a reader over them. Nothing is
+// returned to the caller until the content is known good, so a bad response
+// from one URL can never look like a successful Fetch.
+func (f *URLFetcher) fetchOne(ctx context.Context, ref string, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", ref, err)
+	}
+
+	if _, ok := f.schemes[u.Scheme]; !ok {
+		return nil, fmt.Errorf("scheme %q is not allowed for foreign layer fetch: %q", u.Scheme, ref)
+	}
+
+	if f.hosts != nil {
+		if _, ok := f.hosts[u.Host]; !ok {
+			return nil, fmt.Errorf("host %q is not allowed for foreign layer fetch: %q", u.Host, ref)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %q failed: %w", ref, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %q: %s", ref, resp.Status)
+	}
+
+	return spoolAndVerify(ref, resp.Body, desc)
+}
+
+// spoolAndVerify copies rc to a temp file while hashing it, returning the
+// spooled file (rewound to its start) only if the copied bytes match desc's
+// digest and size; otherwise the temp file is removed and an error is
+// returned.
+func spoolAndVerify(ref string, rc io.Reader, desc ocispec.Descriptor) (_ io.ReadCloser, retErr error) {
+	spool, err := os.CreateTemp("", "containerd-foreign-layer-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file for %q: %w", ref, err)
+	}
+	defer func() {
+		if retErr != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+	}()
+
+	verifier := desc.Digest.Verifier()
+	n, err := io.Copy(spool, io.TeeReader(rc, verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", ref, err)
+	}
+
+	if desc.Size > 0 && n != desc.Size {
+		return nil, fmt.Errorf("unexpected size %d for %s from %q, expected %d", n, desc.Digest, ref, desc.Size)
+	}
+	if !verifier.Verified() {
+		return nil, fmt.Errorf("content from %q does not match digest %s", ref, desc.Digest)
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind spool file for %q: %w", ref, err)
+	}
+
+	return &spooledFile{File: spool}, nil
+}
+
+// spooledFile deletes its backing temp file once the caller closes it.
+type spooledFile struct {
+	*os.File
+}
+
+func (s *spooledFile) Close() error {
+	err := s.File.Close()
+	if rmErr := os.Remove(s.File.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// FetchForeignLayers returns an images.HandlerFunc that fetches
+// foreign/non-distributable layers from the URLs embedded in their
+// descriptor using fetcher, committing the content to store with a
+// containerd.io/distribution.urls label so that a later push can re-emit
+// the descriptor with its URLs intact instead of re-uploading content the
+// source registry never had. Descriptors that are not foreign, or carry no
+// URLs, are passed through to base unchanged.
+func FetchForeignLayers(base images.Handler, store content.Ingester, fetcher *URLFetcher) images.HandlerFunc {
+	return func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if !isNonDistributable(desc.MediaType) || len(desc.URLs) == 0 {
+			return base.Handle(ctx, desc)
+		}
+
+		rc, err := fetcher.Fetch(ctx, desc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch foreign layer %s: %w", desc.Digest, err)
+		}
+		defer rc.Close()
+
+		labels := map[string]string{
+			distributionURLsLabel: strings.Join(desc.URLs, ","),
+		}
+
+		ref := fmt.Sprintf("foreign-layer-%s", desc.Digest)
+		if err := content.WriteBlob(ctx, store, ref, rc, desc, content.WithLabels(labels)); err != nil {
+			return nil, fmt.Errorf("failed to write foreign layer %s: %w", desc.Digest, err)
+		}
+
+		return nil, nil
+	}
+}
@@ -0,0 +1,145 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	_ "crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// TestURLFetcherFallsBackOnBadURL verifies that a URL serving content that
+// doesn't match the descriptor's digest is rejected and the next URL in
+// desc.URLs is tried, rather than being handed back to the caller as a
+// successful Fetch.
+func TestURLFetcherFallsBackOnBadURL(t *testing.T) {
+	ctx := context.Background()
+
+	good := []byte("the real content")
+	dgst := digest.FromBytes(good)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered content"))
+	})
+	mux.HandleFunc("/good", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(good)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := NewURLFetcher(URLFetcherOpts{
+		AllowedSchemes: map[string]struct{}{"http": {}},
+	})
+
+	desc := ocispec.Descriptor{
+		Digest: dgst,
+		Size:   int64(len(good)),
+		URLs:   []string{srv.URL + "/bad", srv.URL + "/good"},
+	}
+
+	rc, err := f.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatalf("expected fetch to fall back to the good URL, got: %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(good) {
+		t.Fatalf("expected content %q, got %q", good, got)
+	}
+}
+
+// TestURLFetcherFallsBackOnHTTPError verifies that a URL returning a non-200
+// status is skipped in favor of the next URL, the same as a URL serving
+// content that fails digest verification.
+func TestURLFetcherFallsBackOnHTTPError(t *testing.T) {
+	ctx := context.Background()
+
+	good := []byte("the real content")
+	dgst := digest.FromBytes(good)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/good", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(good)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := NewURLFetcher(URLFetcherOpts{
+		AllowedSchemes: map[string]struct{}{"http": {}},
+	})
+
+	desc := ocispec.Descriptor{
+		Digest: dgst,
+		Size:   int64(len(good)),
+		URLs:   []string{srv.URL + "/missing", srv.URL + "/good"},
+	}
+
+	rc, err := f.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatalf("expected fetch to fall back past the 404 to the good URL, got: %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(good) {
+		t.Fatalf("expected content %q, got %q", good, got)
+	}
+}
+
+// TestURLFetcherAllURLsBad verifies that Fetch fails when none of desc.URLs
+// serves content matching the descriptor.
+func TestURLFetcherAllURLsBad(t *testing.T) {
+	ctx := context.Background()
+
+	dgst := digest.FromBytes([]byte("the real content"))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered content"))
+	}))
+	defer srv.Close()
+
+	f := NewURLFetcher(URLFetcherOpts{
+		AllowedSchemes: map[string]struct{}{"http": {}},
+	})
+
+	desc := ocispec.Descriptor{
+		Digest: dgst,
+		Size:   16,
+		URLs:   []string{srv.URL},
+	}
+
+	if _, err := f.Fetch(ctx, desc); err == nil {
+		t.Fatal("expected fetch to fail when no URL matches the digest")
+	}
+}
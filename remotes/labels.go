@@ -0,0 +1,108 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+)
+
+// distributionSourceLabelKey returns the content label key used to record
+// the set of repositories on registryHost that are known to already hold a
+// given blob.
+func distributionSourceLabelKey(registryHost string) string {
+	return fmt.Sprintf("containerd.io/distribution.source.%s", registryHost)
+}
+
+// appendDistributionSourceLabel returns the value for
+// distributionSourceLabelKey(registry) after recording that repo also serves
+// the blob, merging with any repositories already present in oldValue. The
+// result is de-duplicated and sorted so repeated calls are idempotent.
+func appendDistributionSourceLabel(oldValue, repo string) string {
+	repos := make(map[string]struct{})
+	for _, r := range strings.Split(oldValue, ",") {
+		if r != "" {
+			repos[r] = struct{}{}
+		}
+	}
+	repos[repo] = struct{}{}
+
+	result := make([]string, 0, len(repos))
+	for r := range repos {
+		result = append(result, r)
+	}
+	sort.Strings(result)
+
+	return strings.Join(result, ",")
+}
+
+// sourceRepos parses the distribution-source label for registry out of
+// labels, returning the list of repositories known to hold the blob and
+// whether the label was present at all.
+func sourceRepos(labels map[string]string, registry string) ([]string, bool) {
+	v, ok := labels[distributionSourceLabelKey(registry)]
+	if !ok || v == "" {
+		return nil, false
+	}
+	return strings.Split(v, ","), true
+}
+
+// LabelDistributionSource wraps f so that, after it fetches and commits a
+// blob, the blob's content info is updated with a
+// containerd.io/distribution.source.<registry> label recording repo. Later
+// pushes of the same blob to registry can use this to attempt a
+// cross-repository mount instead of a full re-upload; see
+// WithCrossRepoMount.
+func LabelDistributionSource(f images.Handler, store content.Manager, registry, repo string) images.HandlerFunc {
+	return func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		children, err := f.Handle(ctx, desc)
+		if err != nil {
+			return children, err
+		}
+
+		if registry == "" || repo == "" {
+			return children, nil
+		}
+
+		info, err := store.Info(ctx, desc.Digest)
+		if err != nil {
+			// Nothing was committed for this descriptor (e.g. it was only
+			// walked, not fetched), so there is nothing to label.
+			return children, nil
+		}
+
+		key := distributionSourceLabelKey(registry)
+		updated := appendDistributionSourceLabel(info.Labels[key], repo)
+		if updated == info.Labels[key] {
+			return children, nil
+		}
+
+		_, err = store.Update(ctx, content.Info{
+			Digest: desc.Digest,
+			Labels: map[string]string{key: updated},
+		}, fmt.Sprintf("labels.%s", key))
+
+		return children, err
+	}
+}
@@ -0,0 +1,61 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"testing"
+)
+
+func TestAppendDistributionSourceLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldValue string
+		repo     string
+		want     string
+	}{
+		{name: "empty", oldValue: "", repo: "library/busybox", want: "library/busybox"},
+		{name: "append new", oldValue: "library/busybox", repo: "library/alpine", want: "library/alpine,library/busybox"},
+		{name: "dedup existing", oldValue: "library/alpine,library/busybox", repo: "library/busybox", want: "library/alpine,library/busybox"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendDistributionSourceLabel(tt.oldValue, tt.repo)
+			if got != tt.want {
+				t.Fatalf("appendDistributionSourceLabel(%q, %q) = %q, want %q", tt.oldValue, tt.repo, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceRepos(t *testing.T) {
+	labels := map[string]string{
+		distributionSourceLabelKey("docker.io"): "library/alpine,library/busybox",
+	}
+
+	repos, ok := sourceRepos(labels, "docker.io")
+	if !ok {
+		t.Fatal("expected docker.io label to be present")
+	}
+	if len(repos) != 2 || repos[0] != "library/alpine" || repos[1] != "library/busybox" {
+		t.Fatalf("unexpected repos: %v", repos)
+	}
+
+	if _, ok := sourceRepos(labels, "ghcr.io"); ok {
+		t.Fatal("expected no label for an unrecorded registry")
+	}
+}
@@ -0,0 +1,75 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/log"
+)
+
+// Mounter is implemented by Pushers whose transport supports mounting a blob
+// from another repository on the same registry without re-uploading its
+// content (e.g. the distribution `mount` upload parameter).
+type Mounter interface {
+	// Mount attempts to mount the blob identified by desc from fromRepo into
+	// the repository the Pusher targets. It returns an error if the registry
+	// rejects or does not support the mount, in which case the caller should
+	// fall back to a normal Push.
+	Mount(ctx context.Context, desc ocispec.Descriptor, fromRepo string) error
+}
+
+// WithCrossRepoMount wraps pusher so that, for blobs carrying a
+// containerd.io/distribution.source.<registry> label recording repositories
+// on registry that already hold the content, a cross-repository mount is
+// attempted before falling back to pusher's normal upload path. If pusher
+// does not implement Mounter, it is returned unwrapped.
+func WithCrossRepoMount(pusher Pusher, store content.Manager, registry string) Pusher {
+	m, ok := pusher.(Mounter)
+	if !ok {
+		return pusher
+	}
+	return &crossRepoMountPusher{Pusher: pusher, mounter: m, store: store, registry: registry}
+}
+
+type crossRepoMountPusher struct {
+	Pusher
+	mounter  Mounter
+	store    content.Manager
+	registry string
+}
+
+func (p *crossRepoMountPusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	info, err := p.store.Info(ctx, desc.Digest)
+	if err == nil {
+		if repos, ok := sourceRepos(info.Labels, p.registry); ok {
+			for _, from := range repos {
+				if err := p.mounter.Mount(ctx, desc, from); err == nil {
+					log.G(ctx).WithField("digest", desc.Digest).WithField("from", from).
+						Debug("mounted blob from source repository, skipping upload")
+					return nil, errdefs.ErrAlreadyExists
+				}
+			}
+		}
+	}
+
+	return p.Pusher.Push(ctx, desc)
+}
@@ -0,0 +1,135 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	_ "crypto/sha256"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+)
+
+// fakeMountingPusher implements both Pusher and Mounter; mounted records the
+// fromRepo of each Mount call, pushed records each descriptor Push was asked
+// to upload, and mountOK controls whether Mount succeeds.
+type fakeMountingPusher struct {
+	mountOK bool
+	mounted []string
+	pushed  []ocispec.Descriptor
+}
+
+func (p *fakeMountingPusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	p.pushed = append(p.pushed, desc)
+	return nil, nil
+}
+
+func (p *fakeMountingPusher) Mount(ctx context.Context, desc ocispec.Descriptor, fromRepo string) error {
+	p.mounted = append(p.mounted, fromRepo)
+	if !p.mountOK {
+		return errdefs.ErrNotImplemented
+	}
+	return nil
+}
+
+func TestWithCrossRepoMountSkipsUploadOnSuccess(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dgst := writeTestBlob(t, ctx, cs, "blob", []byte("content"))
+	if _, err := cs.Update(ctx, content.Info{
+		Digest: dgst,
+		Labels: map[string]string{
+			distributionSourceLabelKey("docker.io"): "library/busybox",
+		},
+	}, "labels."+distributionSourceLabelKey("docker.io")); err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &fakeMountingPusher{mountOK: true}
+	pusher := WithCrossRepoMount(inner, cs, "docker.io")
+
+	_, err = pusher.Push(ctx, ocispec.Descriptor{Digest: dgst})
+	if err != errdefs.ErrAlreadyExists {
+		t.Fatalf("expected ErrAlreadyExists after a successful mount, got: %v", err)
+	}
+	if len(inner.mounted) != 1 || inner.mounted[0] != "library/busybox" {
+		t.Fatalf("expected a mount attempt from library/busybox, got: %v", inner.mounted)
+	}
+	if len(inner.pushed) != 0 {
+		t.Fatal("expected no fallback upload after a successful mount")
+	}
+}
+
+func TestWithCrossRepoMountFallsBackToPush(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dgst := writeTestBlob(t, ctx, cs, "blob", []byte("content"))
+
+	inner := &fakeMountingPusher{mountOK: false}
+	pusher := WithCrossRepoMount(inner, cs, "docker.io")
+
+	if _, err := pusher.Push(ctx, ocispec.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("expected fallback push to succeed, got: %v", err)
+	}
+	if len(inner.pushed) != 1 {
+		t.Fatal("expected a fallback upload when there is no distribution-source label")
+	}
+}
+
+func TestWithCrossRepoMountUnwrapsNonMounter(t *testing.T) {
+	inner := struct{ Pusher }{}
+	if pusher := WithCrossRepoMount(inner, nil, "docker.io"); pusher != inner {
+		t.Fatal("expected a non-Mounter Pusher to be returned unwrapped")
+	}
+}
+
+func writeTestBlob(t *testing.T, ctx context.Context, cs content.Store, ref string, data []byte) digest.Digest {
+	t.Helper()
+
+	w, err := cs.Writer(ctx, content.WithRef(ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	dgst := digest.SHA256.FromBytes(data)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, int64(len(data)), dgst); err != nil {
+		t.Fatal(err)
+	}
+
+	return dgst
+}
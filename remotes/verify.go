@@ -0,0 +1,112 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+)
+
+// VerifyDescriptors wraps f to enforce the OCI image-spec descriptor rules
+// on every descriptor it dispatches, before and after f handles it:
+//
+//   - Digest must parse and pass digest.Digest.Validate().
+//   - Size must be non-negative and, for distributable content, match the
+//     size actually committed to store once f has fetched it.
+//   - MediaType must appear in allowedMediaTypes, unless it is nil, in which
+//     case no media type restriction is applied.
+//
+// This brings the client-side pull path in line with the stricter
+// validation distribution registries perform on manifest PUT, catching
+// malformed or partially-mirrored images early instead of failing mid-unpack.
+func VerifyDescriptors(f images.Handler, store content.Manager, allowedMediaTypes map[string]struct{}) images.HandlerFunc {
+	return func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if err := verifyDescriptorSyntax(desc, allowedMediaTypes); err != nil {
+			return nil, err
+		}
+
+		children, err := f.Handle(ctx, desc)
+		if err != nil {
+			return children, err
+		}
+
+		if err := verifyDescriptorContent(ctx, store, desc); err != nil {
+			return children, err
+		}
+
+		return children, nil
+	}
+}
+
+func verifyDescriptorSyntax(desc ocispec.Descriptor, allowedMediaTypes map[string]struct{}) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return fmt.Errorf("invalid descriptor digest %q: %w", desc.Digest, err)
+	}
+
+	if desc.Size < 0 {
+		return fmt.Errorf("invalid descriptor size %d for %s: %w", desc.Size, desc.Digest, errdefs.ErrInvalidArgument)
+	}
+
+	if allowedMediaTypes != nil {
+		if _, ok := allowedMediaTypes[desc.MediaType]; !ok {
+			return fmt.Errorf("unrecognized media type %q for %s: %w", desc.MediaType, desc.Digest, errdefs.ErrInvalidArgument)
+		}
+	}
+
+	return nil
+}
+
+// verifyDescriptorContent confirms that distributable content referenced by
+// desc actually landed in store with the size the descriptor promised.
+// Non-distributable blobs are exempt, since they are never expected to be
+// present in the local store.
+func verifyDescriptorContent(ctx context.Context, store content.Manager, desc ocispec.Descriptor) error {
+	if isNonDistributable(desc.MediaType) {
+		return nil
+	}
+
+	info, err := store.Info(ctx, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("%s missing from content store after fetch: %w", desc.Digest, errdefs.ErrNotFound)
+	}
+
+	if info.Size != desc.Size {
+		return fmt.Errorf("fetched size %d for %s does not match descriptor size %d: %w", info.Size, desc.Digest, desc.Size, errdefs.ErrInvalidArgument)
+	}
+
+	return nil
+}
+
+func isNonDistributable(mediaType string) bool {
+	//nolint:staticcheck // non-distributable layers are deprecated
+	switch mediaType {
+	case images.MediaTypeDockerSchema2LayerForeign,
+		images.MediaTypeDockerSchema2LayerForeignGzip,
+		ocispec.MediaTypeImageLayerNonDistributable,
+		ocispec.MediaTypeImageLayerNonDistributableGzip,
+		ocispec.MediaTypeImageLayerNonDistributableZstd:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+	_ "crypto/sha256"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+)
+
+func TestVerifyDescriptorSyntax(t *testing.T) {
+	valid := digest.FromString("hello")
+	allowed := map[string]struct{}{images.MediaTypeDockerSchema2Manifest: {}}
+
+	tests := []struct {
+		name    string
+		desc    ocispec.Descriptor
+		allowed map[string]struct{}
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			desc:    ocispec.Descriptor{Digest: valid, Size: 5, MediaType: images.MediaTypeDockerSchema2Manifest},
+			allowed: allowed,
+		},
+		{
+			name:    "invalid digest",
+			desc:    ocispec.Descriptor{Digest: "not-a-digest", Size: 5, MediaType: images.MediaTypeDockerSchema2Manifest},
+			allowed: allowed,
+			wantErr: true,
+		},
+		{
+			name:    "negative size",
+			desc:    ocispec.Descriptor{Digest: valid, Size: -1, MediaType: images.MediaTypeDockerSchema2Manifest},
+			allowed: allowed,
+			wantErr: true,
+		},
+		{
+			name:    "disallowed media type",
+			desc:    ocispec.Descriptor{Digest: valid, Size: 5, MediaType: "application/unknown"},
+			allowed: allowed,
+			wantErr: true,
+		},
+		{
+			name:    "nil allow-list permits any media type",
+			desc:    ocispec.Descriptor{Digest: valid, Size: 5, MediaType: "application/unknown"},
+			allowed: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyDescriptorSyntax(tt.desc, tt.allowed)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("verifyDescriptorSyntax() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDescriptorContent(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("hello world")
+	w, err := cs.Writer(ctx, content.WithRef("blob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.SHA256.FromBytes(data)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, int64(len(data)), dgst); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	if err := verifyDescriptorContent(ctx, cs, ocispec.Descriptor{Digest: dgst, Size: int64(len(data))}); err != nil {
+		t.Fatalf("expected matching size to verify, got: %v", err)
+	}
+
+	if err := verifyDescriptorContent(ctx, cs, ocispec.Descriptor{Digest: dgst, Size: int64(len(data)) + 1}); err == nil {
+		t.Fatal("expected mismatched size to fail verification")
+	}
+
+	missing := digest.FromString("does-not-exist")
+	if err := verifyDescriptorContent(ctx, cs, ocispec.Descriptor{Digest: missing, Size: 1}); err == nil {
+		t.Fatal("expected missing content to fail verification")
+	}
+
+	//nolint:staticcheck // non-distributable layers are deprecated
+	foreign := ocispec.Descriptor{
+		Digest:    missing,
+		Size:      1,
+		MediaType: images.MediaTypeDockerSchema2LayerForeign,
+	}
+	if err := verifyDescriptorContent(ctx, cs, foreign); err != nil {
+		t.Fatalf("expected non-distributable descriptor to be exempt, got: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rootfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/snapshots"
+)
+
+// Compression identifies a target layer compression for CreateDiffs.
+type Compression string
+
+const (
+	Uncompressed Compression = "uncompressed"
+	Gzip         Compression = "gzip"
+	Zstd         Compression = "zstd"
+
+	// Estargz identifies the estargz format. Unlike Uncompressed, Gzip and
+	// Zstd, it has no built-in compressor here: estargz's reference
+	// implementation lives outside containerd's module graph, so callers
+	// that want it must import it and call
+	// RegisterCompression(Estargz, mediaType, fn) during init before
+	// passing Estargz to CreateDiffs. Passing it unregistered fails with an
+	// "unregistered compression" error rather than silently falling back
+	// to another format.
+	Estargz Compression = "estargz"
+)
+
+// uncompressedAnnotation cross-references a compressed layer variant back to
+// the uncompressed digest it was derived from, so callers can recognize
+// variants of the same diff without recomputing it.
+const uncompressedAnnotation = "containerd.io/uncompressed"
+
+var builtinMediaTypes = map[Compression]string{
+	Uncompressed: imagespec.MediaTypeImageLayer,
+	Gzip:         imagespec.MediaTypeImageLayerGzip,
+	Zstd:         imagespec.MediaTypeImageLayerZstd,
+}
+
+// CompressionWriter compresses the tar stream read from src, writing the
+// result to dst. It is used to plug in compressions, such as estargz, that
+// do not live in containerd's own module graph.
+type CompressionWriter func(dst io.Writer, src io.Reader) error
+
+var externalCompressors = map[Compression]CompressionWriter{}
+
+// RegisterCompression makes c, identified by mediaType and produced by fn,
+// available as a target compression for CreateDiffs.
+func RegisterCompression(c Compression, mediaType string, fn CompressionWriter) {
+	builtinMediaTypes[c] = mediaType
+	externalCompressors[c] = fn
+}
+
+// CreateDiffs behaves like CreateDiff, but produces one descriptor per
+// requested compression. The (possibly expensive) comparison against the
+// snapshot's parent is only run once, to produce an uncompressed tar
+// stream; each requested compression reads that stream back from the
+// content store and writes its own blob, rather than re-diffing per format.
+// Compressed variants are committed with a containerd.io/uncompressed label
+// pointing at the shared uncompressed digest. Requesting Estargz without a
+// prior RegisterCompression(Estargz, ...) call fails that variant with an
+// "unregistered compression" error; it does not fall back to another
+// format.
+func CreateDiffs(ctx context.Context, snapshotID string, sn snapshots.Snapshotter, d diff.Comparer, cs content.Store, compressions ...Compression) (map[Compression]imagespec.Descriptor, error) {
+	if len(compressions) == 0 {
+		compressions = []Compression{Gzip}
+	}
+
+	uncompressed, err := CreateDiff(ctx, snapshotID, sn, d, WithContentStore(cs), WithDiffOpts(diff.WithMediaType(imagespec.MediaTypeImageLayer)))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[Compression]imagespec.Descriptor, len(compressions))
+	var mu sync.Mutex
+
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, c := range compressions {
+		c := c
+		if c == Uncompressed {
+			out[c] = uncompressed
+			continue
+		}
+
+		eg.Go(func() error {
+			desc, err := compressVariant(ctx, cs, uncompressed, c)
+			if err != nil {
+				return fmt.Errorf("failed to create %s layer variant of %s: %w", c, uncompressed.Digest, err)
+			}
+
+			mu.Lock()
+			out[c] = desc
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+func compressVariant(ctx context.Context, cs content.Store, uncompressed imagespec.Descriptor, c Compression) (imagespec.Descriptor, error) {
+	mediaType, ok := builtinMediaTypes[c]
+	if !ok {
+		return imagespec.Descriptor{}, fmt.Errorf("unregistered compression %q", c)
+	}
+
+	ra, err := cs.ReaderAt(ctx, uncompressed)
+	if err != nil {
+		return imagespec.Descriptor{}, fmt.Errorf("failed to read uncompressed diff %s: %w", uncompressed.Digest, err)
+	}
+	defer ra.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeCompressed(pw, content.NewReader(ra), c))
+	}()
+
+	dgstr := digest.SHA256.Digester()
+	buf, err := io.ReadAll(io.TeeReader(pr, dgstr.Hash()))
+	if err != nil {
+		return imagespec.Descriptor{}, err
+	}
+
+	desc := imagespec.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgstr.Digest(),
+		Size:      int64(len(buf)),
+		Annotations: map[string]string{
+			uncompressedAnnotation: uncompressed.Digest.String(),
+		},
+	}
+
+	ref := fmt.Sprintf("compress-%s-%s", c, uncompressed.Digest)
+	if err := content.WriteBlob(ctx, cs, ref, bytes.NewReader(buf), desc, content.WithLabels(map[string]string{
+		uncompressedAnnotation: uncompressed.Digest.String(),
+	})); err != nil {
+		return imagespec.Descriptor{}, fmt.Errorf("failed to commit %s layer %s: %w", c, desc.Digest, err)
+	}
+
+	return desc, nil
+}
+
+func writeCompressed(dst io.Writer, src io.Reader, c Compression) error {
+	if fn, ok := externalCompressors[c]; ok {
+		return fn(dst, src)
+	}
+
+	var kind compression.Compression
+	switch c {
+	case Gzip:
+		kind = compression.Gzip
+	case Zstd:
+		kind = compression.Zstd
+	default:
+		return fmt.Errorf("no compressor registered for %q", c)
+	}
+
+	cw, err := compression.CompressStream(dst, kind)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(cw, src); err != nil {
+		cw.Close()
+		return err
+	}
+
+	return cw.Close()
+}
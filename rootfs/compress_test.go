@@ -0,0 +1,130 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rootfs
+
+import (
+	"bytes"
+	"context"
+	_ "crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+)
+
+func TestCompressVariantUnregisteredCompression(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uncompressed := writeBlob(t, ctx, cs, "uncompressed", []byte("hello"))
+
+	if _, err := compressVariant(ctx, cs, uncompressed, Estargz); err == nil {
+		t.Fatal("expected compressVariant to fail for an unregistered compression")
+	}
+}
+
+func TestCompressVariantGzip(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	cs, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := []byte(strings.Repeat("hello world ", 64))
+	uncompressed := writeBlob(t, ctx, cs, "uncompressed", raw)
+
+	desc, err := compressVariant(ctx, cs, uncompressed, Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if desc.MediaType != imagespec.MediaTypeImageLayerGzip {
+		t.Fatalf("unexpected media type: %s", desc.MediaType)
+	}
+	if desc.Annotations[uncompressedAnnotation] != uncompressed.Digest.String() {
+		t.Fatalf("expected uncompressed annotation %s, got %v", uncompressed.Digest, desc.Annotations)
+	}
+
+	info, err := cs.Info(ctx, desc.Digest)
+	if err != nil {
+		t.Fatalf("expected gzip variant to be committed: %v", err)
+	}
+	if info.Labels[uncompressedAnnotation] != uncompressed.Digest.String() {
+		t.Fatalf("expected uncompressed label %s, got %v", uncompressed.Digest, info.Labels)
+	}
+}
+
+// TestRegisterCompressionUsesExternalCompressor verifies that a compression
+// registered via RegisterCompression is what writeCompressed invokes,
+// rather than falling through to the builtin gzip/zstd cases — this is the
+// extension point estargz support is meant to plug into.
+func TestRegisterCompressionUsesExternalCompressor(t *testing.T) {
+	const testCompression Compression = "test-external"
+	called := false
+	RegisterCompression(testCompression, "application/vnd.test.layer", func(dst io.Writer, src io.Reader) error {
+		called = true
+		_, err := io.Copy(dst, src)
+		return err
+	})
+
+	var buf bytes.Buffer
+	if err := writeCompressed(&buf, strings.NewReader("payload"), testCompression); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expected the registered external compressor to be invoked")
+	}
+	if buf.String() != "payload" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+func writeBlob(t *testing.T, ctx context.Context, cs content.Store, ref string, data []byte) imagespec.Descriptor {
+	t.Helper()
+
+	w, err := cs.Writer(ctx, content.WithRef(ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	dgst := digest.SHA256.FromBytes(data)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, int64(len(data)), dgst); err != nil {
+		t.Fatal(err)
+	}
+
+	return imagespec.Descriptor{
+		MediaType: imagespec.MediaTypeImageLayer,
+		Digest:    dgst,
+		Size:      int64(len(data)),
+	}
+}
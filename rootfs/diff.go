@@ -20,24 +20,114 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/opencontainers/go-digest"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 
+	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/diff"
 	"github.com/containerd/containerd/mount"
 	"github.com/containerd/containerd/pkg/cleanup"
 	"github.com/containerd/containerd/snapshots"
 )
 
+const (
+	// snapshotRefLabel, when present on a snapshot, names a content-store
+	// digest that CreateDiff may reuse instead of running a fresh
+	// comparison, provided it still matches the snapshot's diffIDLabel.
+	// Snapshotters that know a snapshot carries no changes on top of an
+	// existing layer (e.g. one created solely by unpacking that layer) can
+	// set both labels to let CreateDiff skip the comparison.
+	snapshotRefLabel = "containerd.io/snapshot.ref"
+	diffIDLabel      = "containerd.io/snapshot/diffID"
+
+	chainIDAnnotation      = "containerd.io/snapshot/chainID"
+	parentDigestAnnotation = "containerd.io/snapshot/parentDigest"
+	snapshotterAnnotation  = "containerd.io/snapshot/snapshotter"
+)
+
+type options struct {
+	snapshotter string
+	cs          content.Store
+	noShortcut  bool
+	diffOpts    []diff.Opt
+}
+
+// Opt configures CreateDiff.
+type Opt func(*options)
+
+// WithSnapshotterName records name in the returned descriptor's
+// containerd.io/snapshot/snapshotter annotation.
+func WithSnapshotterName(name string) Opt {
+	return func(o *options) {
+		o.snapshotter = name
+	}
+}
+
+// WithContentStore enables the snapshot-label shortcut: when set, CreateDiff
+// consults cs for a previously computed diff before running the comparer.
+func WithContentStore(cs content.Store) Opt {
+	return func(o *options) {
+		o.cs = cs
+	}
+}
+
+// WithoutSnapshotShortcut disables reuse of a content-store blob referenced
+// by the snapshot's containerd.io/snapshot.ref label, forcing CreateDiff to
+// always run a fresh comparison. Callers that need a guaranteed up-to-date
+// diff, rather than the last-known-good one, should set this.
+func WithoutSnapshotShortcut() Opt {
+	return func(o *options) {
+		o.noShortcut = true
+	}
+}
+
+// WithDiffOpts forwards opts to the underlying diff.Comparer when CreateDiff
+// actually runs a comparison.
+func WithDiffOpts(opts ...diff.Opt) Opt {
+	return func(o *options) {
+		o.diffOpts = append(o.diffOpts, opts...)
+	}
+}
+
 // CreateDiff creates a layer diff for the given snapshot identifier from the
 // parent of the snapshot. A content ref is provided to track the progress of
 // the content creation and the provided snapshotter and mount differ are used
 // for calculating the diff. The descriptor for the layer diff is returned.
-func CreateDiff(ctx context.Context, snapshotID string, sn snapshots.Snapshotter, d diff.Comparer, opts ...diff.Opt) (imagespec.Descriptor, error) {
+//
+// The returned descriptor's Annotations record the snapshot chain-id, the
+// parent snapshot, and (if WithSnapshotterName was given) the snapshotter
+// name, so that callers further down the commit/export path can relate the
+// diff back to the snapshot it came from.
+//
+// If WithContentStore is set and the snapshot carries a
+// containerd.io/snapshot.ref label whose value matches both a blob already
+// present in the content store and the snapshot's recorded diff-id, that
+// blob is reused instead of running the comparer again. This lets commit
+// paths avoid re-diffing a snapshot that was created by unpacking an
+// existing image with no changes on top; pass WithoutSnapshotShortcut to
+// always force a fresh diff.
+func CreateDiff(ctx context.Context, snapshotID string, sn snapshots.Snapshotter, d diff.Comparer, opts ...Opt) (imagespec.Descriptor, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	info, err := sn.Stat(ctx, snapshotID)
 	if err != nil {
 		return imagespec.Descriptor{}, err
 	}
 
+	parentChainID, err := parentChainID(ctx, sn, info)
+	if err != nil {
+		return imagespec.Descriptor{}, err
+	}
+
+	if !o.noShortcut && o.cs != nil {
+		if desc, ok := reuseSnapshotDiff(ctx, o.cs, info); ok {
+			return annotateDiff(ctx, sn, snapshotID, desc, info, parentChainID, o.snapshotter)
+		}
+	}
+
 	lowerKey := fmt.Sprintf("%s-parent-view-%s", info.Parent, uniquePart())
 	lower, err := sn.View(ctx, lowerKey, info.Parent)
 	if err != nil {
@@ -64,5 +154,97 @@ func CreateDiff(ctx context.Context, snapshotID string, sn snapshots.Snapshotter
 		})
 	}
 
-	return d.Compare(ctx, lower, upper, opts...)
+	desc, err := d.Compare(ctx, lower, upper, o.diffOpts...)
+	if err != nil {
+		return imagespec.Descriptor{}, err
+	}
+
+	return annotateDiff(ctx, sn, snapshotID, desc, info, parentChainID, o.snapshotter)
+}
+
+// parentChainID returns the chain ID recorded on info's parent snapshot, or
+// the empty string if info has no parent. It is the parent's chain id, not
+// info's own, that feeds the chainID computation for info's diff.
+func parentChainID(ctx context.Context, sn snapshots.Snapshotter, info snapshots.Info) (string, error) {
+	if info.Parent == "" {
+		return "", nil
+	}
+
+	pinfo, err := sn.Stat(ctx, info.Parent)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat parent snapshot %s: %w", info.Parent, err)
+	}
+
+	return pinfo.Labels[chainIDAnnotation], nil
+}
+
+// reuseSnapshotDiff looks for a content-store blob that can stand in for a
+// fresh diff of info: info must carry snapshotRefLabel naming a digest, that
+// digest must be present in cs, and it must match info's recorded diffIDLabel
+// (the snapshotter's attestation that the snapshot introduces no changes
+// beyond that layer).
+func reuseSnapshotDiff(ctx context.Context, cs content.Store, info snapshots.Info) (imagespec.Descriptor, bool) {
+	ref, ok := info.Labels[snapshotRefLabel]
+	if !ok || ref == "" {
+		return imagespec.Descriptor{}, false
+	}
+
+	dgst, err := digest.Parse(ref)
+	if err != nil {
+		return imagespec.Descriptor{}, false
+	}
+
+	if info.Labels[diffIDLabel] != dgst.String() {
+		return imagespec.Descriptor{}, false
+	}
+
+	cinfo, err := cs.Info(ctx, dgst)
+	if err != nil {
+		return imagespec.Descriptor{}, false
+	}
+
+	return imagespec.Descriptor{
+		MediaType: imagespec.MediaTypeImageLayer,
+		Digest:    dgst,
+		Size:      cinfo.Size,
+	}, true
+}
+
+// annotateDiff sets desc's chain-id, parent-snapshot and snapshotter
+// annotations, and persists the computed chain id back onto snapshotID's own
+// labels so that a later CreateDiff of a child snapshot can read it as its
+// parent's chain id.
+func annotateDiff(ctx context.Context, sn snapshots.Snapshotter, snapshotID string, desc imagespec.Descriptor, info snapshots.Info, parentChainID string, snapshotterName string) (imagespec.Descriptor, error) {
+	if desc.Annotations == nil {
+		desc.Annotations = make(map[string]string, 3)
+	}
+
+	cid := chainID(desc.Digest, parentChainID).String()
+	desc.Annotations[chainIDAnnotation] = cid
+	if info.Parent != "" {
+		desc.Annotations[parentDigestAnnotation] = info.Parent
+	}
+	if snapshotterName != "" {
+		desc.Annotations[snapshotterAnnotation] = snapshotterName
+	}
+
+	if _, err := sn.Update(ctx, snapshots.Info{
+		Name:   snapshotID,
+		Labels: map[string]string{chainIDAnnotation: cid},
+	}, fmt.Sprintf("labels.%s", chainIDAnnotation)); err != nil {
+		return desc, fmt.Errorf("failed to record chain id on snapshot %s: %w", snapshotID, err)
+	}
+
+	return desc, nil
+}
+
+// chainID computes the OCI chain ID for a layer whose own diff digest is
+// diffID, given the chain ID of its parent (parentChainID may be empty for
+// the first layer in an image), following the algorithm described in the
+// OCI image-spec: chainID(n) = digest(chainID(n-1) + " " + diffID(n)).
+func chainID(diffID digest.Digest, parentChainID string) digest.Digest {
+	if parentChainID == "" {
+		return diffID
+	}
+	return digest.FromString(parentChainID + " " + diffID.String())
 }
@@ -0,0 +1,125 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rootfs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+)
+
+// fakeSnapshotter implements snapshots.Snapshotter with just enough backing
+// (an in-memory Info map) for Stat/Update; every other method except Close
+// is unused by these tests and panics if called.
+type fakeSnapshotter struct {
+	infos map[string]snapshots.Info
+}
+
+func newFakeSnapshotter() *fakeSnapshotter {
+	return &fakeSnapshotter{infos: map[string]snapshots.Info{}}
+}
+
+func (s *fakeSnapshotter) Stat(ctx context.Context, key string) (snapshots.Info, error) {
+	info, ok := s.infos[key]
+	if !ok {
+		return snapshots.Info{}, fmt.Errorf("snapshot %s not found", key)
+	}
+	return info, nil
+}
+
+func (s *fakeSnapshotter) Update(ctx context.Context, info snapshots.Info, fieldpaths ...string) (snapshots.Info, error) {
+	existing := s.infos[info.Name]
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	for k, v := range info.Labels {
+		existing.Labels[k] = v
+	}
+	existing.Name = info.Name
+	s.infos[info.Name] = existing
+	return existing, nil
+}
+
+func (s *fakeSnapshotter) Usage(ctx context.Context, key string) (snapshots.Usage, error) {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) Mounts(ctx context.Context, key string) ([]mount.Mount, error) {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) View(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) Commit(ctx context.Context, name, key string, opts ...snapshots.Opt) error {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) Remove(ctx context.Context, key string) error {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) Walk(ctx context.Context, fn snapshots.WalkFunc, filters ...string) error {
+	panic("not implemented")
+}
+func (s *fakeSnapshotter) Close() error { return nil }
+
+func TestAnnotateDiffChainIDAccumulates(t *testing.T) {
+	ctx := context.Background()
+	sn := newFakeSnapshotter()
+
+	sn.infos["base"] = snapshots.Info{Name: "base"}
+	firstDiffID := digest.FromString("layer-1")
+	firstDesc, err := annotateDiff(ctx, sn, "base", imagespec.Descriptor{Digest: firstDiffID}, snapshots.Info{Name: "base"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstDesc.Annotations[chainIDAnnotation] != firstDiffID.String() {
+		t.Fatalf("expected first layer's chain id to equal its diff id, got %s", firstDesc.Annotations[chainIDAnnotation])
+	}
+	if sn.infos["base"].Labels[chainIDAnnotation] != firstDiffID.String() {
+		t.Fatalf("expected chain id to be persisted on the snapshot, got labels: %v", sn.infos["base"].Labels)
+	}
+
+	sn.infos["top"] = snapshots.Info{Name: "top", Parent: "base"}
+	parentCID, err := parentChainID(ctx, sn, sn.infos["top"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parentCID != firstDiffID.String() {
+		t.Fatalf("expected parent chain id %s, got %s", firstDiffID, parentCID)
+	}
+
+	secondDiffID := digest.FromString("layer-2")
+	secondDesc, err := annotateDiff(ctx, sn, "top", imagespec.Descriptor{Digest: secondDiffID}, sn.infos["top"], parentCID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := digest.FromString(firstDiffID.String() + " " + secondDiffID.String())
+	if secondDesc.Annotations[chainIDAnnotation] != expected.String() {
+		t.Fatalf("expected accumulated chain id %s, got %s", expected, secondDesc.Annotations[chainIDAnnotation])
+	}
+	if secondDesc.Annotations[chainIDAnnotation] == secondDiffID.String() {
+		t.Fatal("second layer's chain id must not equal its own diff id")
+	}
+}